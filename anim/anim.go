@@ -0,0 +1,133 @@
+package anim
+
+import (
+	"github.com/supermuesli/pathtracer/camera"
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/vec3"
+	"sort"
+)
+
+type Interpolation int
+
+const (
+	Linear Interpolation = iota
+	Bezier
+)
+
+// keyframe of a scalar track. In and Out are the values of the bezier
+// handles before and after the key, Interp is used towards the next key
+type Key struct {
+	Time float64
+	Value float64
+	In, Out float64
+	Interp Interpolation
+}
+
+// keyframed scalar, e.g. a light intensity or a field of view
+type Track struct {
+	Keys []Key
+}
+
+// adds a key to the track. bezier handles default to the key's value, which
+// eases in and out of the key
+func (t *Track) Add(time float64, value float64, interp Interpolation) *Track {
+	t.Keys = append(t.Keys, Key{time, value, value, value, interp})
+	sort.SliceStable(t.Keys, func(i, j int) bool { return t.Keys[i].Time < t.Keys[j].Time })
+	return t
+}
+
+// evaluates the track at the given time. the first and last key are held
+// before and after the animated range
+func (t *Track) At(time float64) float64 {
+	if len(t.Keys) == 0 {
+		return 0
+	}
+
+	if time <= t.Keys[0].Time {
+		return t.Keys[0].Value
+	}
+
+	last := len(t.Keys) - 1
+	if time >= t.Keys[last].Time {
+		return t.Keys[last].Value
+	}
+
+	// index of the first key after time
+	i := sort.Search(len(t.Keys), func(i int) bool { return t.Keys[i].Time > time })
+	k0 := t.Keys[i-1]
+	k1 := t.Keys[i]
+	s := (time - k0.Time) / (k1.Time - k0.Time)
+
+	if k0.Interp == Bezier {
+		r := 1 - s
+		return r*r*r*k0.Value + 3*r*r*s*k0.Out + 3*r*s*s*k1.In + s*s*s*k1.Value
+	}
+
+	return k0.Value + s*(k1.Value-k0.Value)
+}
+
+// keyframed vector, stored as one track per component
+type Vec3_track struct {
+	X, Y, Z Track
+}
+
+func (t *Vec3_track) Add(time float64, value vec3.Vec3, interp Interpolation) *Vec3_track {
+	t.X.Add(time, value.X, interp)
+	t.Y.Add(time, value.Y, interp)
+	t.Z.Add(time, value.Z, interp)
+	return t
+}
+
+func (t *Vec3_track) At(time float64) vec3.Vec3 {
+	return vec3.Vec3{t.X.At(time), t.Y.At(time), t.Z.At(time)}
+}
+
+func (t *Vec3_track) Empty() bool {
+	return len(t.X.Keys) == 0
+}
+
+// keyframed object transform. rotation holds the angles around the x, y
+// and z axis (in radians), which are applied in that order
+type Transform_track struct {
+	Translation Vec3_track
+	Rotation Vec3_track
+	Scale Track
+}
+
+func (t *Transform_track) At(time float64) object.Transform {
+	scale := 1.0
+	if len(t.Scale.Keys) > 0 {
+		scale = t.Scale.At(time)
+	}
+
+	r := t.Rotation.At(time)
+	p := t.Translation.At(time)
+
+	res := object.Scaling(scale, scale, scale)
+	res = object.Rotation_x(r.X).Mul(res)
+	res = object.Rotation_y(r.Y).Mul(res)
+	res = object.Rotation_z(r.Z).Mul(res)
+	res = object.Translation(p.X, p.Y, p.Z).Mul(res)
+	return res
+}
+
+// keyframed camera. tracks without keys leave the camera untouched
+type Camera_track struct {
+	Origin Vec3_track
+	Target Vec3_track
+	Fov Track
+}
+
+func (t *Camera_track) Apply(cam *camera.Camera, time float64) {
+	if !t.Origin.Empty() {
+		cam.Origin = t.Origin.At(time)
+	}
+
+	if !t.Target.Empty() {
+		cam.Target = t.Target.At(time)
+	}
+
+	if len(t.Fov.Keys) > 0 {
+		cam.Fov = t.Fov.At(time)
+	}
+}
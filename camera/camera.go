@@ -2,15 +2,51 @@ package camera
 
 import (
 	"github.com/supermuesli/pathtracer/vec3"
+	"math"
 )
 
 type Camera struct {
 	Width, Height int
 	Origin vec3.Vec3
+	// point the camera looks at
+	Target vec3.Vec3
+	// horizontal field of view in radians
+	Fov float64
+	// shutter interval in seconds, relative to the start of the frame
+	Shutter_open, Shutter_close float64
 }
 
 func (c *Camera) Move(x float64, y float64, z float64) {
 	c.Origin.X += x
 	c.Origin.Y += y
 	c.Origin.Z += z
-}
\ No newline at end of file
+}
+
+// returns the normalized direction of the camera ray through pixel (x, y)
+func (c *Camera) Ray_dir(x float64, y float64) vec3.Vec3 {
+	forward := c.Target
+	forward.Sub(c.Origin)
+	forward.Normalize()
+
+	// image y grows downwards just like world y does
+	right := vec3.Vec3{0, 1, 0}
+	if math.Abs(forward.Y) > 0.999 {
+		// looking straight up or down, y can't tell left from right
+		right = vec3.Vec3{0, 0, 1}
+	}
+	right.Cross(forward)
+	right.Normalize()
+	down := forward
+	down.Cross(right)
+
+	// size of a pixel on a view plane at distance 1
+	pixel_size := math.Tan(c.Fov/2) / (float64(c.Width) / 2)
+	right.Scale((x - float64(c.Width)/2) * pixel_size)
+	down.Scale((y - float64(c.Height)/2) * pixel_size)
+
+	dir := forward
+	dir.Add(right)
+	dir.Add(down)
+	dir.Normalize()
+	return dir
+}
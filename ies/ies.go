@@ -0,0 +1,218 @@
+package ies
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// luminous intensity distribution of a luminaire from an ies lm-63 file.
+// only type c photometry is supported, which is what nearly all interior
+// fixtures ship with. vertical angles start at the nadir, the direction the
+// fixture points at, horizontal angles go around it
+type Profile struct {
+	// angles in degrees, ascending
+	Vertical []float64
+	Horizontal []float64
+	// candela for every horizontal angle, over all vertical angles
+	Candela [][]float64
+	// largest candela value of the profile
+	Peak float64
+	// average of At over the sphere, relates the peak to the total flux
+	average float64
+}
+
+// loads an ies lm-63 file
+func Load(path string) (*Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// parses the contents of an ies lm-63 file, any of the 1986 to 2019 versions
+func Parse(data string) (*Profile, error) {
+	// keywords come before the tilt line, numbers after it
+	lines := strings.Split(strings.ReplaceAll(data, "\r", ""), "\n")
+	tilt := -1
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "TILT=") {
+			tilt = i
+			break
+		}
+	}
+	if tilt < 0 {
+		return nil, errors.New("missing TILT line")
+	}
+
+	var numbers []float64
+	for _, line := range lines[tilt+1:] {
+		for _, field := range strings.Fields(strings.ReplaceAll(line, ",", " ")) {
+			f, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %q", field)
+			}
+			numbers = append(numbers, f)
+		}
+	}
+	next := func(n int) ([]float64, error) {
+		if n < 0 || len(numbers) < n {
+			return nil, errors.New("unexpected end of file")
+		}
+		res := numbers[:n]
+		numbers = numbers[n:]
+		return res, nil
+	}
+
+	// the lamp tilt only matters for lamps that change output with their
+	// orientation, it is skipped
+	if strings.TrimSpace(lines[tilt]) == "TILT=INCLUDE" {
+		head, err := next(2)
+		if err != nil {
+			return nil, err
+		}
+		// checked as a float, huge counts and nan don't survive the conversion
+		if !(head[1] >= 0 && head[1] <= float64(len(numbers))) {
+			return nil, fmt.Errorf("bad tilt angle count %v", head[1])
+		}
+		if _, err := next(2 * int(head[1])); err != nil {
+			return nil, err
+		}
+	}
+
+	header, err := next(13)
+	if err != nil {
+		return nil, err
+	}
+	multiplier := header[2]
+	n_vertical, n_horizontal := int(header[3]), int(header[4])
+	if header[5] != 1 {
+		return nil, fmt.Errorf("unsupported photometric type %v", header[5])
+	}
+	if n_vertical < 1 || n_horizontal < 1 {
+		return nil, errors.New("no angles")
+	}
+	// ballast factor and the ballast lamp factor of old files, newer files
+	// leave the latter at 1
+	for _, f := range header[10:12] {
+		if f > 0 {
+			multiplier *= f
+		}
+	}
+
+	p := &Profile{}
+	if p.Vertical, err = next(n_vertical); err != nil {
+		return nil, err
+	}
+	if p.Horizontal, err = next(n_horizontal); err != nil {
+		return nil, err
+	}
+	if !sort.Float64sAreSorted(p.Vertical) || !sort.Float64sAreSorted(p.Horizontal) {
+		return nil, errors.New("angles are not ascending")
+	}
+
+	p.Candela = make([][]float64, n_horizontal)
+	for i := range p.Candela {
+		if p.Candela[i], err = next(n_vertical); err != nil {
+			return nil, err
+		}
+		for j := range p.Candela[i] {
+			p.Candela[i][j] *= multiplier
+			p.Peak = math.Max(p.Peak, p.Candela[i][j])
+		}
+	}
+	if p.Peak <= 0 {
+		return nil, errors.New("profile is dark")
+	}
+
+	// midpoint rule over the sphere
+	const steps = 64
+	sum := 0.0
+	for i := 0; i < steps; i++ {
+		theta := math.Pi * (float64(i) + 0.5) / steps
+		for j := 0; j < 2*steps; j++ {
+			phi := math.Pi * (float64(j) + 0.5) / steps
+			sum += p.At(theta, phi) * math.Sin(theta)
+		}
+	}
+	p.average = sum * math.Pi * math.Pi / (steps * steps) / (4 * math.Pi)
+
+	return p, nil
+}
+
+// intensity relative to the peak, theta is the angle to the nadir and phi
+// the horizontal angle, both in radians
+func (p *Profile) At(theta float64, phi float64) float64 {
+	v := theta * 180 / math.Pi
+	h := math.Mod(phi*180/math.Pi, 360)
+	if h < 0 {
+		h += 360
+	}
+
+	// the horizontal angles only cover what the symmetry of the fixture
+	// doesn't repeat
+	switch last := p.Horizontal[len(p.Horizontal)-1]; {
+	case last == 0:
+		h = 0
+	case last == 90:
+		h = math.Mod(h, 180)
+		if h > 90 {
+			h = 180 - h
+		}
+	case last == 180:
+		if h > 180 {
+			h = 360 - h
+		}
+	}
+
+	// no light outside of the measured vertical angles
+	if v < p.Vertical[0] || v > p.Vertical[len(p.Vertical)-1] {
+		return 0
+	}
+
+	i, s := bracket(p.Horizontal, h)
+	j, t := bracket(p.Vertical, v)
+	at := func(i int, j int) float64 {
+		if i >= len(p.Horizontal) {
+			i = len(p.Horizontal) - 1
+		}
+		if j >= len(p.Vertical) {
+			j = len(p.Vertical) - 1
+		}
+		return p.Candela[i][j]
+	}
+	c := (1-s)*((1-t)*at(i, j)+t*at(i, j+1)) + s*((1-t)*at(i+1, j)+t*at(i+1, j+1))
+	return c / p.Peak
+}
+
+// average relative intensity over all directions. a light whose peak
+// intensity is I radiates a total of 4 pi I Average()
+func (p *Profile) Average() float64 {
+	return p.average
+}
+
+// index of the last angle at or below x and the position of x between it
+// and the next one
+func bracket(angles []float64, x float64) (int, float64) {
+	i := sort.SearchFloat64s(angles, x)
+	if i < len(angles) && angles[i] == x {
+		return i, 0
+	}
+	if i == 0 {
+		return 0, 0
+	}
+	if i == len(angles) {
+		// past the last angle its value is kept
+		return len(angles) - 1, 0
+	}
+	return i - 1, (x - angles[i-1]) / (angles[i] - angles[i-1])
+}
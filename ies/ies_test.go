@@ -0,0 +1,112 @@
+package ies
+
+import (
+	"math"
+	"testing"
+)
+
+// one lamp of 1000 lumens, candela multiplier 0.5, 3 vertical and 1
+// horizontal angle, type c, no ballast factors
+const tilt_none = `IESNA:LM-63-2002
+[TEST] spot
+[MANUFAC] nobody
+TILT=NONE
+1 1000 0.5 3 1 1 2 0 0 0
+1 1 100
+0 90 180
+0
+200 0 0
+`
+
+// two horizontal angles, quadrant symmetric, behind a lamp tilt table and
+// with a ballast factor of 0.5
+const tilt_include = `IESNA:LM-63-2002
+TILT=INCLUDE
+1
+3
+0 45 90
+1 0.9 0.8
+1 1000 1 3 2 1 2 0 0 0
+0.5 1 100
+0 90 180
+0 90
+100 100 100
+50 50 50
+`
+
+func near(a float64, b float64, eps float64) bool {
+	return math.Abs(a-b) <= eps
+}
+
+func Test_parse_tilt_none(t *testing.T) {
+	p, err := Parse(tilt_none)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Peak != 100 {
+		t.Errorf("peak %v, want 100", p.Peak)
+	}
+
+	// falls off linearly from the nadir to the horizon
+	for _, c := range []struct{ theta, phi, want float64 }{
+		{0, 0, 1},
+		{math.Pi / 4, 1, 0.5},
+		{math.Pi / 2, 2, 0},
+		{3, 0, 0},
+	} {
+		if got := p.At(c.theta, c.phi); !near(got, c.want, 1e-9) {
+			t.Errorf("At(%v, %v) = %v, want %v", c.theta, c.phi, got, c.want)
+		}
+	}
+
+	// (1 - 2 theta / pi) over the lower hemisphere
+	if want := (1 - 2/math.Pi) / 2; !near(p.Average(), want, 1e-3) {
+		t.Errorf("average %v, want %v", p.Average(), want)
+	}
+}
+
+func Test_parse_tilt_include(t *testing.T) {
+	p, err := Parse(tilt_include)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Peak != 50 {
+		t.Errorf("peak %v, want 50", p.Peak)
+	}
+
+	// 270 degrees mirror 90 degrees, 45 lies halfway
+	for _, c := range []struct{ phi, want float64 }{
+		{0, 1},
+		{math.Pi / 4, 0.75},
+		{math.Pi / 2, 0.5},
+		{3 * math.Pi / 2, 0.5},
+		{math.Pi, 1},
+	} {
+		if got := p.At(1, c.phi); !near(got, c.want, 1e-9) {
+			t.Errorf("At(1, %v) = %v, want %v", c.phi, got, c.want)
+		}
+	}
+	if !near(p.Average(), 0.75, 1e-3) {
+		t.Errorf("average %v, want 0.75", p.Average())
+	}
+}
+
+func Test_parse_malformed(t *testing.T) {
+	for _, c := range []struct{ name, data, err string }{
+		{"no tilt", "IESNA:LM-63-2002\n1 1000 1 1 1 1 2 0 0 0\n1 1 100\n0\n0\n100\n", "missing TILT line"},
+		{"type b", "TILT=NONE\n1 1000 1 1 1 2 2 0 0 0\n1 1 100\n0\n0\n100\n", "unsupported photometric type 2"},
+		{"no angles", "TILT=NONE\n1 1000 1 0 1 1 2 0 0 0\n1 1 100\n0\n100\n", "no angles"},
+		{"truncated", "TILT=NONE\n1 1000 1 3 1 1 2 0 0 0\n1 1 100\n0 90 180\n0\n100 50\n", "unexpected end of file"},
+		{"descending", "TILT=NONE\n1 1000 1 2 1 1 2 0 0 0\n1 1 100\n90 0\n0\n100 50\n", "angles are not ascending"},
+		{"dark", "TILT=NONE\n1 1000 1 1 1 1 2 0 0 0\n1 1 100\n0\n0\n0\n", "profile is dark"},
+		{"garbage", "TILT=NONE\n1 1000 one\n", `bad number "one"`},
+		// the count of tilt angles used to slice the numbers unchecked
+		{"negative tilt count", "TILT=INCLUDE\n1 -3\n1 1000 1 1 1 1 2 0 0 0\n1 1 100\n0\n0\n100\n", "bad tilt angle count -3"},
+		{"huge tilt count", "TILT=INCLUDE\n1 1e300\n1 1000 1 1 1 1 2 0 0 0\n1 1 100\n0\n0\n100\n", "bad tilt angle count 1e+300"},
+		{"nan tilt count", "TILT=INCLUDE\n1 NaN\n1 1000 1 1 1 1 2 0 0 0\n1 1 100\n0\n0\n100\n", "bad tilt angle count NaN"},
+	} {
+		if _, err := Parse(c.data); err == nil || err.Error() != c.err {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+		}
+	}
+}
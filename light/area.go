@@ -0,0 +1,168 @@
+package light
+
+import (
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// emissive primitive of the scene, sampled by picking points on its
+// surface. spheres are sampled by the directions they cover instead. like
+// any emissive surface it emits from both sides
+type Area struct {
+	Shape object.Shape
+	Mterial *object.Material
+	// where to find the primitive in the scene, see object.HitRecord
+	Object_id, Prim_id int
+}
+
+// returns an area light for every emissive triangle, sphere and analytic
+// primitive of finite area among primitives, which have to be in world
+// space. primitives wrapped in an object.Transformed, i.e. moving ones,
+// are only found by bounces
+func Emitters(primitives []object.Shape) []*Area {
+	var res []*Area
+	for i, p := range primitives {
+		switch s := p.(type) {
+		case *object.Object:
+			for j := 0; j < len(s.Mesh); j++ {
+				if s.Mesh[j].Mterial.Emission > 0 {
+					res = append(res, &Area{&s.Mesh[j], &s.Mesh[j].Mterial, i, j})
+				}
+			}
+		case object.Single_material:
+			// a single primitive, its hits have a Prim_id of 0
+			area := s.Area()
+			if s.Material().Emission > 0 && area > 0 && !math.IsInf(area, 1) {
+				res = append(res, &Area{s, s.Material(), i, 0})
+			}
+		}
+	}
+	return res
+}
+
+// finds the surface along dir from p and returns the hit and its pdf with
+// respect to solid angle. the pdf is 0 if the ray misses
+func (l *Area) hit(p vec3.Vec3, dir vec3.Vec3) (object.HitRecord, float64) {
+	rec := object.New_hit_record()
+	if !l.Shape.Hit(&object.Line{p, dir, 0}, &rec) {
+		return rec, 0
+	}
+
+	cos := math.Abs(rec.Geometric_normal.Dot(dir))
+	area := l.Shape.Area()
+	if cos == 0 || area == 0 {
+		return rec, 0
+	}
+
+	// points are picked uniformly by area, seen from p the area shrinks by
+	// the squared distance and the cosine
+	return rec, rec.T * rec.T / (cos * area)
+}
+
+// axis and cosine of the half angle of the cone a sphere subtends from p,
+// and the solid angle of that cone. ok is false if p is inside the sphere
+func sphere_cone(s *object.Sphere, p vec3.Vec3) (vec3.Vec3, float64, float64, bool) {
+	axis, dist := towards(p, s.Origin)
+	if dist <= s.Radius {
+		return axis, 0, 0, false
+	}
+
+	sin2 := s.Radius * s.Radius / (dist * dist)
+	cos := math.Sqrt(math.Max(0, 1-sin2))
+	// 1 - cos without cancellation for small, far away spheres
+	return axis, cos, 2 * math.Pi * sin2 / (1 + cos), true
+}
+
+func (l *Area) Sample(p vec3.Vec3, u1 float64, u2 float64) (vec3.Vec3, float64, vec3.Vec3, float64) {
+	// spheres seen from outside are sampled uniformly within the cone of
+	// directions they cover, every direction hits the near side
+	if s, ok := l.Shape.(*object.Sphere); ok {
+		if axis, cos_max, solid_angle, ok := sphere_cone(s, p); ok {
+			cos_theta := 1 - u1*(1-cos_max)
+			sin_theta := math.Sqrt(math.Max(0, 1-cos_theta*cos_theta))
+			phi := 2 * math.Pi * u2
+			a, b := object.Basis(axis)
+			a.Scale(sin_theta * math.Cos(phi))
+			b.Scale(sin_theta * math.Sin(phi))
+			dir := axis
+			dir.Scale(cos_theta)
+			dir.Add(a)
+			dir.Add(b)
+			dir.Normalize()
+
+			rec := object.New_hit_record()
+			if !s.Hit(&object.Line{p, dir, 0}, &rec) {
+				return dir, math.Inf(1), vec3.Vec3{0, 0, 0}, 0
+			}
+			li := l.Mterial.Emitted(&rec, out(dir))
+			return dir, rec.T, li, 1 / solid_angle
+		}
+	}
+
+	point, normal := l.Shape.Sample(u1, u2)
+	dir, dist := towards(p, point)
+	cos := math.Abs(normal.Dot(dir))
+	area := l.Shape.Area()
+	if cos == 0 || area == 0 {
+		return dir, dist, vec3.Vec3{0, 0, 0}, 0
+	}
+
+	// the first hit along the way yields the texture coordinates for the
+	// emission. if it isn't the sampled point, that point is hidden behind
+	// another part of the same surface
+	rec, _ := l.hit(p, dir)
+	li := vec3.Vec3{0, 0, 0}
+	if rec.T > dist*(1-1e-6)-1e-6 && rec.T < math.Inf(1) {
+		li = l.Mterial.Emitted(&rec, out(dir))
+	}
+
+	return dir, dist, li, dist * dist / (cos * area)
+}
+
+// direction light leaves the surface in to arrive along dir
+func out(dir vec3.Vec3) vec3.Vec3 {
+	dir.Scale(-1)
+	return dir
+}
+
+func (l *Area) Pdf(p vec3.Vec3, dir vec3.Vec3) float64 {
+	dir.Normalize()
+	if s, ok := l.Shape.(*object.Sphere); ok {
+		if axis, cos_max, solid_angle, ok := sphere_cone(s, p); ok {
+			if dir.Dot(axis) < cos_max {
+				return 0
+			}
+			return 1 / solid_angle
+		}
+	}
+	_, pdf := l.hit(p, dir)
+	return pdf
+}
+
+// area lights are already in world space
+func (l *Area) Transform(t object.Transform) Light {
+	return l
+}
+
+func (l *Area) Power(radius float64) float64 {
+	// emits from both sides
+	color := l.Mterial.Emission_color
+	if color.Dot(color) == 0 {
+		color = l.Mterial.Diffuse_color
+	}
+	power := 2 * math.Pi * l.Shape.Area() * l.Mterial.Emission * luminance(color)
+	if l.Mterial.Profile != nil {
+		// the profile spread over the hemisphere of either side
+		power *= math.Min(1, 2*l.Mterial.Profile.Average())
+	}
+	return power
+}
+
+func (l *Area) Bounds() object.Aabb {
+	return l.Shape.Bounds()
+}
+
+func (l *Area) Cone() (vec3.Vec3, float64) {
+	return vec3.Vec3{0, 0, 1}, -1
+}
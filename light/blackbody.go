@@ -0,0 +1,45 @@
+package light
+
+import (
+	"github.com/supermuesli/pathtracer/spectrum"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// planck's law, spectral radiance of a black body at the given temperature
+// in kelvin and wavelength in nanometers
+func planck(kelvin float64, lambda float64) float64 {
+	const (
+		h = 6.62607015e-34
+		c = 2.99792458e8
+		k = 1.380649e-23
+	)
+	l := lambda * 1e-9
+	return 2 * h * c * c / (l * l * l * l * l * (math.Exp(h*c/(l*k*kelvin)) - 1))
+}
+
+// color of a black body at the given temperature in kelvin as linear srgb,
+// scaled to a luminance of 1 so it can be used as the color of any light.
+// candles are around 1900 K, incandescent bulbs 2700 K, daylight 6500 K
+func Blackbody(kelvin float64) vec3.Vec3 {
+	if kelvin <= 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+
+	var cx, cy, cz float64
+	for lambda := 380.0; lambda <= 780; lambda += 5 {
+		x, y, z := spectrum.Cie_xyz(lambda)
+		b := planck(kelvin, lambda)
+		cx += x * b
+		cy += y * b
+		cz += z * b
+	}
+
+	sum := cx + cy + cz
+	res := xyy_to_rgb(cx/sum, cy/sum, 1)
+	// colors outside of the srgb gamut lose their negative parts
+	if l := luminance(res); l > 0 {
+		res.Scale(1 / l)
+	}
+	return res
+}
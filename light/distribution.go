@@ -0,0 +1,109 @@
+package light
+
+import (
+	"sort"
+)
+
+// piecewise constant distribution over [0, 1] with one bucket per value
+type Distribution_1d struct {
+	Func []float64
+	// cumulative distribution, one entry longer than Func
+	Cdf []float64
+	// integral of Func over [0, 1]
+	Integral float64
+}
+
+func New_distribution_1d(f []float64) *Distribution_1d {
+	d := &Distribution_1d{Func: f, Cdf: make([]float64, len(f)+1)}
+	n := float64(len(f))
+	for i := 0; i < len(f); i++ {
+		d.Cdf[i+1] = d.Cdf[i] + f[i]/n
+	}
+	d.Integral = d.Cdf[len(f)]
+
+	// all zero functions are sampled uniformly
+	for i := 1; i <= len(f); i++ {
+		if d.Integral > 0 {
+			d.Cdf[i] /= d.Integral
+		} else {
+			d.Cdf[i] = float64(i) / n
+		}
+	}
+
+	return d
+}
+
+// returns a sample in [0, 1), its pdf and the bucket it lies in
+func (d *Distribution_1d) Sample(u float64) (float64, float64, int) {
+	// last bucket whose cdf is <= u
+	i := sort.Search(len(d.Cdf), func(i int) bool { return d.Cdf[i] > u }) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(d.Func) {
+		i = len(d.Func) - 1
+	}
+
+	du := u - d.Cdf[i]
+	if width := d.Cdf[i+1] - d.Cdf[i]; width > 0 {
+		du /= width
+	}
+
+	return (float64(i) + du) / float64(len(d.Func)), d.Pdf(i), i
+}
+
+// pdf of the samples in bucket i
+func (d *Distribution_1d) Pdf(i int) float64 {
+	if d.Integral == 0 {
+		return 1
+	}
+	return d.Func[i] / d.Integral
+}
+
+// piecewise constant distribution over [0, 1]², e.g. over the pixels of
+// an image. samples pick a row by the marginal distribution first and
+// then a column within it
+type Distribution_2d struct {
+	rows []*Distribution_1d
+	marginal *Distribution_1d
+}
+
+// f holds height rows of width values each
+func New_distribution_2d(f []float64, width int, height int) *Distribution_2d {
+	d := &Distribution_2d{}
+	row_integrals := make([]float64, height)
+	for y := 0; y < height; y++ {
+		row := New_distribution_1d(f[y*width : (y+1)*width])
+		d.rows = append(d.rows, row)
+		row_integrals[y] = row.Integral
+	}
+	d.marginal = New_distribution_1d(row_integrals)
+	return d
+}
+
+// returns u (along a row), v (across rows) and the pdf of the sample
+func (d *Distribution_2d) Sample(u1 float64, u2 float64) (float64, float64, float64) {
+	v, pdf_v, y := d.marginal.Sample(u2)
+	u, pdf_u, _ := d.rows[y].Sample(u1)
+	return u, v, pdf_u * pdf_v
+}
+
+func (d *Distribution_2d) Pdf(u float64, v float64) float64 {
+	y := clamp_index(int(v*float64(len(d.rows))), len(d.rows))
+	row := d.rows[y]
+	x := clamp_index(int(u*float64(len(row.Func))), len(row.Func))
+	if d.marginal.Integral == 0 {
+		return 1
+	}
+	return row.Func[x] / d.marginal.Integral
+}
+
+func clamp_index(i int, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
@@ -0,0 +1,94 @@
+package light
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_distribution_1d(t *testing.T) {
+	f := []float64{1, 3, 0, 4}
+	d := New_distribution_1d(f)
+	if d.Integral != 2 {
+		t.Fatalf("integral %v, want 2", d.Integral)
+	}
+
+	// stratified samples land in the buckets in proportion to f, with the
+	// pdf of their bucket, and estimate the integral of f exactly
+	const n = 8000
+	counts := make([]int, len(f))
+	estimate := 0.0
+	for k := 0; k < n; k++ {
+		x, pdf, i := d.Sample((float64(k) + 0.5) / n)
+		if x < float64(i)/4 || x >= float64(i+1)/4 {
+			t.Fatalf("sample %v outside of its bucket %d", x, i)
+		}
+		if pdf != d.Pdf(i) || pdf != f[i]/d.Integral {
+			t.Fatalf("pdf %v in bucket %d, want %v", pdf, i, f[i]/d.Integral)
+		}
+		counts[i]++
+		estimate += f[i] / pdf / n
+	}
+	for i := range f {
+		if want := n * f[i] / 8; math.Abs(float64(counts[i])-want) > 1 {
+			t.Errorf("bucket %d got %d samples, want %v", i, counts[i], want)
+		}
+	}
+	if math.Abs(estimate-d.Integral) > 1e-9 {
+		t.Errorf("estimated the integral as %v, want %v", estimate, d.Integral)
+	}
+
+	// the sample is the inverse of the cdf
+	if x, _, i := d.Sample(0.125); i != 1 || math.Abs(x-0.25) > 1e-12 {
+		t.Errorf("u = 0.125 maps to %v in bucket %d, want 0.25 in bucket 1", x, i)
+	}
+	if x, _, i := d.Sample(0.75); i != 3 || math.Abs(x-0.875) > 1e-12 {
+		t.Errorf("u = 0.75 maps to %v in bucket %d, want 0.875 in bucket 3", x, i)
+	}
+}
+
+func Test_distribution_1d_zero(t *testing.T) {
+	d := New_distribution_1d([]float64{0, 0, 0, 0})
+	for _, u := range []float64{0, 0.3, 0.6, 0.99} {
+		x, pdf, _ := d.Sample(u)
+		if math.Abs(x-u) > 1e-12 || pdf != 1 {
+			t.Errorf("u = %v maps to %v with pdf %v, want uniform", u, x, pdf)
+		}
+	}
+}
+
+func Test_distribution_2d(t *testing.T) {
+	// 3 columns, 2 rows, the second row twice as bright
+	f := []float64{
+		1, 0, 2,
+		2, 4, 0,
+	}
+	d := New_distribution_2d(f, 3, 2)
+
+	// the pdf integrates to 1 and matches the pdf of the samples
+	integral := 0.0
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			integral += d.Pdf((float64(x)+0.5)/3, (float64(y)+0.5)/2) / 6
+		}
+	}
+	if math.Abs(integral-1) > 1e-12 {
+		t.Errorf("pdf integrates to %v", integral)
+	}
+
+	const n = 90
+	counts := make([]int, 6)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			u, v, pdf := d.Sample((float64(i)+0.5)/n, (float64(j)+0.5)/n)
+			if want := d.Pdf(u, v); math.Abs(pdf-want) > 1e-12 {
+				t.Fatalf("sample (%v, %v) has pdf %v, Pdf says %v", u, v, pdf, want)
+			}
+			counts[int(v*2)*3+int(u*3)]++
+		}
+	}
+	for i, c := range counts {
+		if want := n * n * f[i] / 9; math.Abs(float64(c)-want) > n {
+			t.Errorf("pixel %d got %d samples, want %v", i, c, want)
+		}
+	}
+}
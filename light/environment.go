@@ -0,0 +1,129 @@
+package light
+
+import (
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/texture"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// lights that rays can also find by chance, like the environment. their
+// samples are combined with the bounces that find them by multiple
+// importance sampling, which needs the pdf of sampling a given direction
+type Hittable interface {
+	Light
+	// pdf with respect to solid angle of sampling dir from p
+	Pdf(p vec3.Vec3, dir vec3.Vec3) float64
+}
+
+// infinitely far away light surrounding the scene, seen by every ray that
+// leaves it. the image is an equirectangular map, the top row looking
+// straight up (-y) and u going around the vertical axis
+type Environment struct {
+	Image *texture.Image
+	// turns the map around the vertical axis, in radians
+	Rotation float64
+	// scales the radiance of the map
+	Intensity float64
+	// sampling distribution over the pixels, by luminance
+	distribution *Distribution_2d
+	// average radiance over the sphere
+	average float64
+}
+
+// loads an .hdr or .exr environment map and prepares it for importance sampling
+func Load_environment(path string, rotation float64, intensity float64) (*Environment, error) {
+	img, err := texture.Load_hdr(path, texture.Repeat)
+	if err != nil {
+		return nil, err
+	}
+
+	return New_environment(img, rotation, intensity), nil
+}
+
+func New_environment(img *texture.Image, rotation float64, intensity float64) *Environment {
+	e := &Environment{Image: img, Rotation: rotation, Intensity: intensity}
+
+	// rows near the poles cover a smaller solid angle, so they are picked
+	// less often
+	f := make([]float64, img.Width*img.Height)
+	for y := 0; y < img.Height; y++ {
+		sin_theta := math.Sin(math.Pi * (float64(y) + 0.5) / float64(img.Height))
+		for x := 0; x < img.Width; x++ {
+			f[y*img.Width+x] = luminance(img.Pixels[y*img.Width+x]) * sin_theta
+		}
+	}
+	e.distribution = New_distribution_2d(f, img.Width, img.Height)
+
+	sum := 0.0
+	for _, v := range f {
+		sum += v
+	}
+	// each pixel covers 2 pi² sin(theta) / pixels of the 4 pi sphere
+	e.average = sum / float64(len(f)) * math.Pi / 2
+
+	return e
+}
+
+func luminance(c vec3.Vec3) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
+
+// map coordinates of a unit direction, v is 0 at the top row
+func (e *Environment) uv(dir vec3.Vec3) (float64, float64) {
+	phi := math.Atan2(dir.Z, dir.X) + e.Rotation
+	u := phi / (2 * math.Pi)
+	u -= math.Floor(u)
+	v := math.Acos(math.Max(-1, math.Min(1, -dir.Y))) / math.Pi
+	return u, v
+}
+
+func (e *Environment) direction(u float64, v float64) vec3.Vec3 {
+	phi := 2*math.Pi*u - e.Rotation
+	theta := math.Pi * v
+	return vec3.Vec3{math.Sin(theta) * math.Cos(phi), -math.Cos(theta), math.Sin(theta) * math.Sin(phi)}
+}
+
+// radiance arriving from the given direction. pixels are looked up without
+// filtering, so that the radiance matches the sampling distribution
+func (e *Environment) Radiance(dir vec3.Vec3) vec3.Vec3 {
+	dir.Normalize()
+	u, v := e.uv(dir)
+	x := clamp_index(int(u*float64(e.Image.Width)), e.Image.Width)
+	y := clamp_index(int(v*float64(e.Image.Height)), e.Image.Height)
+	res := e.Image.Pixels[y*e.Image.Width+x]
+	res.Scale(e.Intensity)
+	return res
+}
+
+func (e *Environment) Sample(p vec3.Vec3, u1 float64, u2 float64) (vec3.Vec3, float64, vec3.Vec3, float64) {
+	u, v, pdf := e.distribution.Sample(u1, u2)
+	sin_theta := math.Sin(math.Pi * v)
+	if pdf == 0 || sin_theta == 0 {
+		return vec3.Vec3{0, 1, 0}, math.Inf(1), vec3.Vec3{0, 0, 0}, 0
+	}
+
+	dir := e.direction(u, v)
+	// the map is stretched by 2 pi along u, by pi along v and rows shrink
+	// by sin(theta) towards the poles
+	return dir, math.Inf(1), e.Radiance(dir), pdf / (2 * math.Pi * math.Pi * sin_theta)
+}
+
+func (e *Environment) Pdf(p vec3.Vec3, dir vec3.Vec3) float64 {
+	dir.Normalize()
+	u, v := e.uv(dir)
+	sin_theta := math.Sin(math.Pi * v)
+	if sin_theta == 0 {
+		return 0
+	}
+	return e.distribution.Pdf(u, v) / (2 * math.Pi * math.Pi * sin_theta)
+}
+
+func (e *Environment) Power(radius float64) float64 {
+	return 4 * math.Pi * math.Pi * radius * radius * e.average * e.Intensity
+}
+
+// the environment is infinitely far away, moving it changes nothing
+func (e *Environment) Transform(t object.Transform) Light {
+	return e
+}
@@ -0,0 +1,196 @@
+package light
+
+import (
+	"github.com/supermuesli/pathtracer/ies"
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// light source that isn't part of the geometry. rays can't hit point, spot
+// and directional lights, they only contribute through explicit light
+// sampling in the integrator. intensities are in W/sr and irradiance in
+// W/m², one world unit being one meter
+type Light interface {
+	// samples the light arriving at p. returns the unit direction towards
+	// the light, the distance to it (infinite for directional lights), the
+	// incident radiance and the pdf of the sample. delta lights always
+	// return the same sample with a pdf of 1
+	Sample(p vec3.Vec3, u1 float64, u2 float64) (vec3.Vec3, float64, vec3.Vec3, float64)
+	// copy of the light placed in the world by t
+	Transform(t object.Transform) Light
+	// total emitted power, used to pick between lights. radius is the
+	// radius of the scene, lights at infinity spread their power over it
+	Power(radius float64) float64
+}
+
+// returns the unit direction and distance from p to target
+func towards(p vec3.Vec3, target vec3.Vec3) (vec3.Vec3, float64) {
+	dir := target
+	dir.Sub(p)
+	dist := dir.Euclidean_norm()
+	dir.Scale(1 / dist)
+	return dir, dist
+}
+
+// relative intensity of a profile in the unit direction dir, for a fixture
+// whose nadir points along the unit vector nadir. horizontal angles start
+// at the first vector of object.Basis(nadir)
+func profile_at(p *ies.Profile, nadir vec3.Vec3, dir vec3.Vec3) float64 {
+	if p == nil {
+		return 1
+	}
+	a, b := object.Basis(nadir)
+	theta := math.Acos(math.Max(-1, math.Min(1, dir.Dot(nadir))))
+	return p.At(theta, math.Atan2(dir.Dot(b), dir.Dot(a)))
+}
+
+// radiates equally in all directions, or as a measured fixture does
+type Point struct {
+	Position vec3.Vec3
+	Color vec3.Vec3
+	// radiant intensity in W/sr, the peak intensity with a profile
+	Intensity float64
+	// optional intensity distribution of a real fixture
+	Profile *ies.Profile
+	// where the nadir of the profile points, straight down (+y) if zero
+	Down vec3.Vec3
+}
+
+func (l *Point) down() vec3.Vec3 {
+	if l.Down.Dot(l.Down) == 0 {
+		return vec3.Vec3{0, 1, 0}
+	}
+	res := l.Down
+	res.Normalize()
+	return res
+}
+
+func (l *Point) Sample(p vec3.Vec3, u1 float64, u2 float64) (vec3.Vec3, float64, vec3.Vec3, float64) {
+	dir, dist := towards(p, l.Position)
+	emitted := dir
+	emitted.Scale(-1)
+	li := l.Color
+	// inverse square fall-off
+	li.Scale(profile_at(l.Profile, l.down(), emitted) * l.Intensity / (dist * dist))
+	return dir, dist, li, 1
+}
+
+func (l *Point) Transform(t object.Transform) Light {
+	res := *l
+	res.Position = t.Apply_point(l.Position)
+	res.Down = t.Apply_vector(l.down())
+	res.Down.Normalize()
+	return &res
+}
+
+func (l *Point) Power(radius float64) float64 {
+	power := 4 * math.Pi * l.Intensity * luminance(l.Color)
+	if l.Profile != nil {
+		power *= l.Profile.Average()
+	}
+	return power
+}
+
+func (l *Point) Bounds() object.Aabb {
+	return object.Aabb{l.Position, l.Position}
+}
+
+func (l *Point) Cone() (vec3.Vec3, float64) {
+	return vec3.Vec3{0, 0, 1}, -1
+}
+
+// point light restricted to a cone around Direction. the intensity fades
+// out between the Inner and Outer half angles, given in radians
+type Spot struct {
+	Position, Direction vec3.Vec3
+	Color vec3.Vec3
+	// radiant intensity in W/sr inside the inner cone
+	Intensity float64
+	Inner, Outer float64
+	// optional intensity distribution of a real fixture, its nadir points
+	// along Direction. it is multiplied with the fade of the cone, so
+	// leave Outer wide to use the profile alone
+	Profile *ies.Profile
+}
+
+func (l *Spot) Sample(p vec3.Vec3, u1 float64, u2 float64) (vec3.Vec3, float64, vec3.Vec3, float64) {
+	dir, dist := towards(p, l.Position)
+
+	axis := l.Direction
+	axis.Normalize()
+	cos := -dir.Dot(axis)
+	cos_inner, cos_outer := math.Cos(l.Inner), math.Cos(l.Outer)
+
+	// smoothstep between the outer and the inner cone
+	falloff := 1.0
+	if cos_inner > cos_outer {
+		x := math.Max(0, math.Min(1, (cos-cos_outer)/(cos_inner-cos_outer)))
+		falloff = x * x * (3 - 2*x)
+	} else if cos < cos_outer {
+		falloff = 0
+	}
+
+	emitted := dir
+	emitted.Scale(-1)
+	falloff *= profile_at(l.Profile, axis, emitted)
+
+	li := l.Color
+	li.Scale(falloff * l.Intensity / (dist * dist))
+	return dir, dist, li, 1
+}
+
+func (l *Spot) Transform(t object.Transform) Light {
+	res := *l
+	res.Position = t.Apply_point(l.Position)
+	res.Direction = t.Apply_vector(l.Direction)
+	res.Direction.Normalize()
+	return &res
+}
+
+func (l *Spot) Power(radius float64) float64 {
+	// the fade between the cones is counted as half
+	power := 2 * math.Pi * l.Intensity * (1 - (math.Cos(l.Inner)+math.Cos(l.Outer))/2) * luminance(l.Color)
+	if l.Profile != nil {
+		power = math.Min(power, 4*math.Pi*l.Intensity*l.Profile.Average()*luminance(l.Color))
+	}
+	return power
+}
+
+func (l *Spot) Bounds() object.Aabb {
+	return object.Aabb{l.Position, l.Position}
+}
+
+func (l *Spot) Cone() (vec3.Vec3, float64) {
+	axis := l.Direction
+	axis.Normalize()
+	return axis, math.Cos(l.Outer)
+}
+
+// infinitely far away light, like the sun, shining along Direction
+type Directional struct {
+	Direction vec3.Vec3
+	Color vec3.Vec3
+	// irradiance in W/m² on a surface facing the light
+	Irradiance float64
+}
+
+func (l *Directional) Sample(p vec3.Vec3, u1 float64, u2 float64) (vec3.Vec3, float64, vec3.Vec3, float64) {
+	dir := l.Direction
+	dir.Normalize()
+	dir.Scale(-1)
+	li := l.Color
+	li.Scale(l.Irradiance)
+	return dir, math.Inf(1), li, 1
+}
+
+func (l *Directional) Transform(t object.Transform) Light {
+	res := *l
+	res.Direction = t.Apply_vector(l.Direction)
+	res.Direction.Normalize()
+	return &res
+}
+
+func (l *Directional) Power(radius float64) float64 {
+	return math.Pi * radius * radius * l.Irradiance * luminance(l.Color)
+}
@@ -0,0 +1,334 @@
+package light
+
+import (
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"sort"
+)
+
+// picks one of the lights of a scene to sample at a shading point with
+// position p and normal n
+type Sampler interface {
+	// returns the chosen light and the probability of choosing it, or nil
+	// if no light can reach p
+	Sample(p vec3.Vec3, n vec3.Vec3, u float64) (Light, float64)
+	// probability of choosing l at p
+	Pmf(p vec3.Vec3, n vec3.Vec3, l Light) float64
+}
+
+// chooses lights by their power, wherever the shading point is
+type Power_sampler struct {
+	lights []Light
+	distribution *Distribution_1d
+	index map[Light]int
+}
+
+func New_power_sampler(lights []Light, radius float64) *Power_sampler {
+	s := &Power_sampler{lights: lights, index: map[Light]int{}}
+	power := make([]float64, len(lights))
+	for i, l := range lights {
+		power[i] = l.Power(radius)
+		s.index[l] = i
+	}
+	if len(lights) > 0 {
+		s.distribution = New_distribution_1d(power)
+	}
+	return s
+}
+
+func (s *Power_sampler) Sample(p vec3.Vec3, n vec3.Vec3, u float64) (Light, float64) {
+	if len(s.lights) == 0 {
+		return nil, 0
+	}
+	_, pmf, i := s.distribution.Sample(u)
+	return s.lights[i], pmf / float64(len(s.lights))
+}
+
+func (s *Power_sampler) Pmf(p vec3.Vec3, n vec3.Vec3, l Light) float64 {
+	i, ok := s.index[l]
+	if !ok {
+		return 0
+	}
+	return s.distribution.Pdf(i) / float64(len(s.lights))
+}
+
+// lights with a position in the scene, they can be sorted into a light bvh
+type Bounded interface {
+	Light
+	Bounds() object.Aabb
+	// unit axis and cosine of the half angle of the cone of directions the
+	// light emits into. a cosine of -1 means all directions
+	Cone() (vec3.Vec3, float64)
+}
+
+// directions around axis up to the angle whose cosine is cos
+type cone struct {
+	axis vec3.Vec3
+	cos float64
+}
+
+func angle_between(a vec3.Vec3, b vec3.Vec3) float64 {
+	return math.Acos(math.Max(-1, math.Min(1, a.Dot(b))))
+}
+
+// smallest cone containing a and b
+func union_cone(a cone, b cone) cone {
+	theta_a, theta_b := math.Acos(a.cos), math.Acos(b.cos)
+	theta_d := angle_between(a.axis, b.axis)
+	if math.Min(theta_d+theta_b, math.Pi) <= theta_a {
+		return a
+	}
+	if math.Min(theta_d+theta_a, math.Pi) <= theta_b {
+		return b
+	}
+
+	theta_o := (theta_a + theta_d + theta_b) / 2
+	if theta_o >= math.Pi {
+		return cone{a.axis, -1}
+	}
+
+	// turn the axis of a towards b, (k x v) sin(r) + v cos(r) for k
+	// perpendicular to v
+	k := a.axis
+	k.Cross(b.axis)
+	if k.Dot(k) < 1e-12 {
+		return cone{a.axis, -1}
+	}
+	k.Normalize()
+	r := theta_o - theta_a
+	axis := k
+	axis.Cross(a.axis)
+	axis.Scale(math.Sin(r))
+	v := a.axis
+	v.Scale(math.Cos(r))
+	axis.Add(v)
+	axis.Normalize()
+	return cone{axis, math.Cos(theta_o)}
+}
+
+type light_node struct {
+	box object.Aabb
+	cone cone
+	power float64
+	// children, or -1 for leaves
+	left, right int
+	parent int
+	// the light of a leaf
+	light Light
+}
+
+// picks lights by their estimated contribution to the shading point, which
+// takes their power, distance and orientation into account. the lights are
+// organized in a bounding volume hierarchy whose nodes bound the position,
+// power and emitted directions of all lights below them, so thousands of
+// lights only cost a few steps down the tree. lights at infinity are
+// picked by their power alongside the tree
+type Bvh_sampler struct {
+	nodes []light_node
+	// leaf of every light in the tree
+	leaves map[Light]int
+	infinite *Power_sampler
+	// probability of picking the tree instead of one of the infinite lights
+	p_tree float64
+}
+
+func New_bvh_sampler(lights []Light, radius float64) *Bvh_sampler {
+	s := &Bvh_sampler{leaves: map[Light]int{}}
+
+	var bounded []Bounded
+	var infinite []Light
+	infinite_power := 0.0
+	for _, l := range lights {
+		if b, ok := l.(Bounded); ok && l.Power(radius) > 0 {
+			bounded = append(bounded, b)
+		} else if !ok {
+			infinite = append(infinite, l)
+			infinite_power += l.Power(radius)
+		}
+	}
+	s.infinite = New_power_sampler(infinite, radius)
+
+	if len(bounded) > 0 {
+		s.build(bounded, radius, -1)
+	}
+
+	// the tree and the infinite lights share the samples by their power
+	switch {
+	case len(s.nodes) == 0:
+		s.p_tree = 0
+	case len(infinite) == 0:
+		s.p_tree = 1
+	case s.nodes[0].power+infinite_power > 0:
+		s.p_tree = s.nodes[0].power / (s.nodes[0].power + infinite_power)
+	default:
+		s.p_tree = 0.5
+	}
+	return s
+}
+
+// builds the subtree over lights and returns its index
+func (s *Bvh_sampler) build(lights []Bounded, radius float64, parent int) int {
+	idx := len(s.nodes)
+	s.nodes = append(s.nodes, light_node{parent: parent, left: -1, right: -1})
+
+	if len(lights) == 1 {
+		l := lights[0]
+		axis, cos := l.Cone()
+		s.nodes[idx].box = l.Bounds()
+		s.nodes[idx].cone = cone{axis, cos}
+		s.nodes[idx].power = l.Power(radius)
+		s.nodes[idx].light = l
+		s.leaves[l] = idx
+		return idx
+	}
+
+	// split at the median along the longest axis of the centers
+	centers := object.Empty_aabb()
+	for _, l := range lights {
+		centers.Extend(center(l.Bounds()))
+	}
+	extent := centers.Max
+	extent.Sub(centers.Min)
+	axis := func(p vec3.Vec3) float64 { return p.X }
+	if extent.Y > extent.X && extent.Y > extent.Z {
+		axis = func(p vec3.Vec3) float64 { return p.Y }
+	} else if extent.Z > extent.X {
+		axis = func(p vec3.Vec3) float64 { return p.Z }
+	}
+	sort.Slice(lights, func(i, j int) bool { return axis(center(lights[i].Bounds())) < axis(center(lights[j].Bounds())) })
+
+	mid := len(lights) / 2
+	left := s.build(lights[:mid], radius, idx)
+	right := s.build(lights[mid:], radius, idx)
+
+	box := s.nodes[left].box
+	box.Union(s.nodes[right].box)
+	s.nodes[idx].box = box
+	s.nodes[idx].cone = union_cone(s.nodes[left].cone, s.nodes[right].cone)
+	s.nodes[idx].power = s.nodes[left].power + s.nodes[right].power
+	s.nodes[idx].left, s.nodes[idx].right = left, right
+	return idx
+}
+
+func center(b object.Aabb) vec3.Vec3 {
+	c := b.Min
+	c.Add(b.Max)
+	c.Scale(0.5)
+	return c
+}
+
+// conservative estimate of how much light from below node reaches p. the
+// angles are widened by the angle the box subtends, so lights that might
+// reach p never get an importance of 0
+func (s *Bvh_sampler) importance(i int, p vec3.Vec3, n vec3.Vec3) float64 {
+	node := &s.nodes[i]
+	c := center(node.box)
+	to_p := p
+	to_p.Sub(c)
+	diagonal := node.box.Max
+	diagonal.Sub(node.box.Min)
+	radius := diagonal.Euclidean_norm() / 2
+
+	// lights closer than the size of the node aren't told apart by distance
+	dist2 := math.Max(to_p.Dot(to_p), radius*radius)
+	if dist2 == 0 {
+		return node.power
+	}
+	dist := math.Sqrt(to_p.Dot(to_p))
+
+	// angle of the box seen from p
+	theta_b := math.Pi
+	if dist > radius {
+		theta_b = math.Asin(radius / dist)
+	}
+
+	w := to_p
+	if dist > 0 {
+		w.Scale(1 / dist)
+	}
+
+	// emitted towards p?
+	cos_emit := 1.0
+	if node.cone.cos > -1 {
+		theta := angle_between(node.cone.axis, w) - math.Acos(node.cone.cos) - theta_b
+		if theta >= math.Pi/2 {
+			return 0
+		}
+		cos_emit = math.Cos(math.Max(0, theta))
+	}
+
+	// arriving in front of the surface?
+	cos_surface := 1.0
+	if n.Dot(n) > 0 && dist > radius {
+		incident := w
+		incident.Scale(-1)
+		theta := angle_between(n, incident) - theta_b
+		if theta >= math.Pi/2 {
+			return 0
+		}
+		cos_surface = math.Cos(math.Max(0, theta))
+	}
+
+	return node.power * cos_emit * cos_surface / dist2
+}
+
+func (s *Bvh_sampler) Sample(p vec3.Vec3, n vec3.Vec3, u float64) (Light, float64) {
+	p_tree := s.p_tree
+	if u >= p_tree {
+		l, pmf := s.infinite.Sample(p, n, (u-p_tree)/(1-p_tree))
+		return l, (1 - p_tree) * pmf
+	}
+
+	u /= p_tree
+	pmf := p_tree
+	i := 0
+	for s.nodes[i].left >= 0 {
+		left := s.importance(s.nodes[i].left, p, n)
+		right := s.importance(s.nodes[i].right, p, n)
+		if left+right == 0 {
+			return nil, 0
+		}
+
+		// reuse u for the next step down the tree
+		p_left := left / (left + right)
+		if u < p_left {
+			u /= p_left
+			pmf *= p_left
+			i = s.nodes[i].left
+		} else {
+			u = (u - p_left) / (1 - p_left)
+			pmf *= 1 - p_left
+			i = s.nodes[i].right
+		}
+		u = math.Min(u, 1-1e-12)
+	}
+
+	return s.nodes[i].light, pmf
+}
+
+func (s *Bvh_sampler) Pmf(p vec3.Vec3, n vec3.Vec3, l Light) float64 {
+	i, ok := s.leaves[l]
+	if !ok {
+		return (1 - s.p_tree) * s.infinite.Pmf(p, n, l)
+	}
+
+	// walk up the tree, the probability of every step down that leads to l
+	pmf := s.p_tree
+	for s.nodes[i].parent >= 0 {
+		parent := s.nodes[i].parent
+		left := s.importance(s.nodes[parent].left, p, n)
+		right := s.importance(s.nodes[parent].right, p, n)
+		if left+right == 0 {
+			return 0
+		}
+		if s.nodes[parent].left == i {
+			pmf *= left / (left + right)
+		} else {
+			pmf *= right / (left + right)
+		}
+		i = parent
+	}
+
+	return pmf
+}
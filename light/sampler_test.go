@@ -0,0 +1,170 @@
+package light
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func point_light(x float64, y float64, z float64, intensity float64) *Point {
+	return &Point{Position: vec3.Vec3{x, y, z}, Color: vec3.Vec3{1, 1, 1}, Intensity: intensity}
+}
+
+func Test_power_sampler(t *testing.T) {
+	dim, bright := point_light(0, 0, 0, 1), point_light(5, 0, 0, 3)
+	s := New_power_sampler([]Light{dim, bright}, 1)
+	p, n := vec3.Vec3{0, 0, 0}, vec3.Vec3{0, 1, 0}
+
+	if pmf := s.Pmf(p, n, dim); math.Abs(pmf-0.25) > 1e-12 {
+		t.Errorf("pmf of the dim light %v, want 0.25", pmf)
+	}
+	if pmf := s.Pmf(p, n, bright); math.Abs(pmf-0.75) > 1e-12 {
+		t.Errorf("pmf of the bright light %v, want 0.75", pmf)
+	}
+	if pmf := s.Pmf(p, n, point_light(0, 0, 0, 1)); pmf != 0 {
+		t.Errorf("pmf %v of a light the sampler doesn't know", pmf)
+	}
+
+	const samples = 1000
+	picked := 0
+	for i := 0; i < samples; i++ {
+		l, pmf := s.Sample(p, n, (float64(i)+0.5)/samples)
+		if pmf != s.Pmf(p, n, l) {
+			t.Fatalf("sampled with pmf %v, Pmf says %v", pmf, s.Pmf(p, n, l))
+		}
+		if l == bright {
+			picked++
+		}
+	}
+	if picked != 750 {
+		t.Errorf("picked the bright light %d times out of %d, want 750", picked, samples)
+	}
+
+	if l, pmf := New_power_sampler(nil, 1).Sample(p, n, 0.5); l != nil || pmf != 0 {
+		t.Errorf("empty sampler picked %v with pmf %v", l, pmf)
+	}
+}
+
+// point lights scattered through a box and two suns
+func test_lights() []Light {
+	rng := rand.New(rand.NewSource(2))
+	var lights []Light
+	for i := 0; i < 40; i++ {
+		lights = append(lights, point_light(rng.Float64()*100, rng.Float64()*100, rng.Float64()*100, 1+rng.Float64()*10))
+	}
+	lights = append(lights,
+		&Directional{Direction: vec3.Vec3{0, 1, 0}, Color: vec3.Vec3{1, 1, 1}, Irradiance: 0.01},
+		&Directional{Direction: vec3.Vec3{1, 1, 0}, Color: vec3.Vec3{1, 1, 1}, Irradiance: 0.03},
+	)
+	return lights
+}
+
+func Test_bvh_sampler_pmf(t *testing.T) {
+	lights := test_lights()
+	s := New_bvh_sampler(lights, 50)
+	rng := rand.New(rand.NewSource(3))
+
+	for k := 0; k < 50; k++ {
+		p := vec3.Vec3{rng.Float64() * 100, rng.Float64() * 100, rng.Float64() * 100}
+		n := vec3.Vec3{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}
+		n.Normalize()
+		if k%5 == 0 {
+			// points inside media have no normal
+			n = vec3.Vec3{0, 0, 0}
+		}
+
+		// the pmfs of all lights sum up to 1 without a normal. subtrees
+		// entirely behind the surface pick no light at all
+		sum := 0.0
+		for _, l := range lights {
+			sum += s.Pmf(p, n, l)
+		}
+		if sum > 1+1e-9 || (n.Dot(n) == 0 && math.Abs(sum-1) > 1e-9) {
+			t.Fatalf("pmfs at %v with normal %v sum up to %v", p, n, sum)
+		}
+
+		// and are what sampling reports
+		for i := 0; i < 20; i++ {
+			l, pmf := s.Sample(p, n, rng.Float64())
+			if l == nil {
+				if sum > 1-1e-9 {
+					t.Fatalf("no light picked at %v", p)
+				}
+				continue
+			}
+			if want := s.Pmf(p, n, l); math.Abs(pmf-want) > 1e-9*want {
+				t.Fatalf("sampled with pmf %v, Pmf says %v", pmf, want)
+			}
+		}
+	}
+}
+
+func Test_bvh_sampler_frequencies(t *testing.T) {
+	lights := test_lights()
+	s := New_bvh_sampler(lights, 50)
+	p, n := vec3.Vec3{50, 50, 50}, vec3.Vec3{0, -1, 0}
+
+	const samples = 200000
+	counts := map[Light]int{}
+	for i := 0; i < samples; i++ {
+		l, _ := s.Sample(p, n, (float64(i)+0.5)/samples)
+		counts[l]++
+	}
+	sum := 0.0
+	for _, l := range lights {
+		want := s.Pmf(p, n, l)
+		sum += want
+		if got := float64(counts[l]) / samples; math.Abs(got-want) > 1e-3 {
+			t.Errorf("picked %v in %v of the samples, want %v", l, got, want)
+		}
+	}
+	if got := float64(counts[nil]) / samples; math.Abs(got-(1-sum)) > 1e-3 {
+		t.Errorf("picked no light in %v of the samples, want %v", got, 1-sum)
+	}
+}
+
+func Test_bvh_sampler_infinite_share(t *testing.T) {
+	lights := test_lights()
+	s := New_bvh_sampler(lights, 50)
+
+	// the suns get their share of all power, split between them by power
+	tree, infinite := 0.0, 0.0
+	for _, l := range lights {
+		if _, ok := l.(Bounded); ok {
+			tree += l.Power(50)
+		} else {
+			infinite += l.Power(50)
+		}
+	}
+	p, n := vec3.Vec3{50, 50, 50}, vec3.Vec3{0, 0, 0}
+	for _, l := range lights[len(lights)-2:] {
+		want := l.Power(50) / (tree + infinite)
+		if pmf := s.Pmf(p, n, l); math.Abs(pmf-want) > 1e-12 {
+			t.Errorf("pmf of %v is %v, want %v", l, pmf, want)
+		}
+	}
+
+	// only infinite lights, or none at all
+	only := New_bvh_sampler(lights[len(lights)-2:], 50)
+	if pmf := only.Pmf(p, n, lights[len(lights)-1]); math.Abs(pmf-0.75) > 1e-12 {
+		t.Errorf("pmf of the brighter sun alone %v, want 0.75", pmf)
+	}
+	if l, pmf := New_bvh_sampler(nil, 50).Sample(p, n, 0.5); l != nil || pmf != 0 {
+		t.Errorf("empty sampler picked %v with pmf %v", l, pmf)
+	}
+}
+
+func Test_bvh_sampler_behind_surface(t *testing.T) {
+	// one light above and one below a surface facing up (-y)
+	above, below := point_light(0, -10, 0, 1), point_light(0, 10, 0, 1)
+	s := New_bvh_sampler([]Light{above, below}, 50)
+	p, n := vec3.Vec3{0, 0, 0}, vec3.Vec3{0, -1, 0}
+
+	if pmf := s.Pmf(p, n, below); pmf != 0 {
+		t.Errorf("pmf %v of a light behind the surface", pmf)
+	}
+	if pmf := s.Pmf(p, n, above); math.Abs(pmf-1) > 1e-12 {
+		t.Errorf("pmf %v of the only light in front of the surface", pmf)
+	}
+}
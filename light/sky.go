@@ -0,0 +1,246 @@
+package light
+
+import (
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/texture"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"time"
+)
+
+// lights surrounding the whole scene, seen by rays that leave it
+type Infinite interface {
+	Hittable
+	// radiance arriving from the given direction
+	Radiance(dir vec3.Vec3) vec3.Vec3
+}
+
+const (
+	// resolution the sky dome is tabulated at
+	sky_width = 256
+	sky_height = 128
+	// angular radius of the sun as seen from the earth
+	sun_radius = 0.00465
+	// luminance of the sun outside of the atmosphere relative to the
+	// luminance of the sky in kcd/m²
+	sun_luminance = 1.6e5
+)
+
+// daylight sky after preetham, shirley and smits, "a practical analytic
+// model for daylight", with the sun as a small disk. at an Intensity of 1
+// the sky radiance is its luminance in kcd/m²
+type Sky struct {
+	// unit direction towards the sun
+	Sun vec3.Vec3
+	// haziness of the atmosphere, 2 is a clear sky and 10 a hazy one
+	Turbidity float64
+	Intensity float64
+	// the sky without the sun, tabulated for importance sampling
+	dome *Environment
+	sun_radiance vec3.Vec3
+	// probability of sampling the sun instead of the dome
+	sun_probability float64
+}
+
+// direction towards the sun from its elevation above the horizon and its
+// azimuth clockwise from north, both in radians. north is +z, east is +x
+// and up is -y
+func Sun_direction(elevation float64, azimuth float64) vec3.Vec3 {
+	return vec3.Vec3{math.Cos(elevation) * math.Sin(azimuth), -math.Sin(elevation), math.Cos(elevation) * math.Cos(azimuth)}
+}
+
+// elevation and azimuth of the sun at the given time and place, latitude
+// and longitude in degrees (north and east are positive). uses the
+// approximations of the noaa solar calculator, good to a fraction of a degree
+func Sun_position(t time.Time, latitude float64, longitude float64) (float64, float64) {
+	t = t.UTC()
+	hours := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	year := 2 * math.Pi / 365 * (float64(t.YearDay()-1) + (hours-12)/24)
+
+	equation_of_time := 229.18 * (0.000075 + 0.001868*math.Cos(year) - 0.032077*math.Sin(year) -
+		0.014615*math.Cos(2*year) - 0.040849*math.Sin(2*year))
+	declination := 0.006918 - 0.399912*math.Cos(year) + 0.070257*math.Sin(year) -
+		0.006758*math.Cos(2*year) + 0.000907*math.Sin(2*year) -
+		0.002697*math.Cos(3*year) + 0.00148*math.Sin(3*year)
+
+	// true solar time in minutes and the hour angle, 0 at solar noon
+	solar_time := hours*60 + equation_of_time + 4*longitude
+	hour_angle := (solar_time/4 - 180) * math.Pi / 180
+
+	lat := latitude * math.Pi / 180
+	cos_zenith := math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Cos(hour_angle)
+	zenith := math.Acos(math.Max(-1, math.Min(1, cos_zenith)))
+
+	azimuth := math.Atan2(math.Sin(hour_angle), math.Cos(hour_angle)*math.Sin(lat)-math.Tan(declination)*math.Cos(lat)) + math.Pi
+	return math.Pi/2 - zenith, math.Mod(azimuth, 2*math.Pi)
+}
+
+func New_sky(sun vec3.Vec3, turbidity float64, intensity float64) *Sky {
+	sun.Normalize()
+	s := &Sky{Sun: sun, Turbidity: turbidity, Intensity: intensity}
+
+	// an unrotated environment maps the pixels to their directions
+	img := &texture.Image{Width: sky_width, Height: sky_height, Pixels: make([]vec3.Vec3, sky_width*sky_height)}
+	layout := &Environment{}
+	for y := 0; y < sky_height; y++ {
+		for x := 0; x < sky_width; x++ {
+			dir := layout.direction((float64(x)+0.5)/sky_width, (float64(y)+0.5)/sky_height)
+			img.Pixels[y*sky_width+x] = s.sky(dir)
+		}
+	}
+	s.dome = New_environment(img, 0, intensity)
+
+	s.sun_radiance = s.sun()
+
+	// pick the sun by its share of the power arriving from above
+	sky_power := 0.0
+	for y := 0; y < sky_height; y++ {
+		sin_theta := math.Sin(math.Pi * (float64(y) + 0.5) / sky_height)
+		for x := 0; x < sky_width; x++ {
+			sky_power += luminance(img.Pixels[y*sky_width+x]) * sin_theta
+		}
+	}
+	sky_power *= 2 * math.Pi * math.Pi / (sky_width * sky_height)
+	sun_power := luminance(s.sun_radiance) * 2 * math.Pi * (1 - math.Cos(sun_radius))
+	if sun_power+sky_power > 0 {
+		s.sun_probability = sun_power / (sun_power + sky_power)
+	}
+
+	return s
+}
+
+// perez sky luminance distribution, theta is the zenith angle of the view
+// direction and gamma its angle to the sun
+func perez(theta float64, gamma float64, c [5]float64) float64 {
+	return (1 + c[0]*math.Exp(c[1]/math.Max(math.Cos(theta), 0.01))) *
+		(1 + c[2]*math.Exp(c[3]*gamma) + c[4]*math.Cos(gamma)*math.Cos(gamma))
+}
+
+// radiance of the sky dome without the sun, linear srgb
+func (s *Sky) sky(dir vec3.Vec3) vec3.Vec3 {
+	// below the horizon
+	if dir.Y >= 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+
+	t := s.Turbidity
+	theta_s := math.Acos(math.Max(-1, math.Min(1, -s.Sun.Y)))
+	theta := math.Acos(math.Max(-1, math.Min(1, -dir.Y)))
+	gamma := math.Acos(math.Max(-1, math.Min(1, dir.Dot(s.Sun))))
+
+	// zenith luminance in kcd/m² and chromaticity
+	chi := (4.0/9 - t/120) * (math.Pi - 2*theta_s)
+	zenith_y := (4.0453*t-4.9710)*math.Tan(chi) - 0.2155*t + 2.4192
+	th, th2, th3 := theta_s, theta_s*theta_s, theta_s*theta_s*theta_s
+	zenith_x := t*t*(0.00166*th3-0.00375*th2+0.00209*th) +
+		t*(-0.02903*th3+0.06377*th2-0.03202*th+0.00394) +
+		(0.11693*th3 - 0.21196*th2 + 0.06052*th + 0.25886)
+	zenith_yc := t*t*(0.00275*th3-0.00610*th2+0.00317*th) +
+		t*(-0.04214*th3+0.08970*th2-0.04153*th+0.00516) +
+		(0.15346*th3 - 0.26756*th2 + 0.06670*th + 0.26688)
+
+	coeff_y := [5]float64{0.1787*t - 1.4630, -0.3554*t + 0.4275, -0.0227*t + 5.3251, 0.1206*t - 2.5771, -0.0670*t + 0.3703}
+	coeff_x := [5]float64{-0.0193*t - 0.2592, -0.0665*t + 0.0008, -0.0004*t + 0.2125, -0.0641*t - 0.8989, -0.0033*t + 0.0452}
+	coeff_yc := [5]float64{-0.0167*t - 0.2608, -0.0950*t + 0.0092, -0.0079*t + 0.2102, -0.0441*t - 1.6537, -0.0109*t + 0.0529}
+
+	lum := math.Max(0, zenith_y*perez(theta, gamma, coeff_y)/perez(0, theta_s, coeff_y))
+	x := zenith_x * perez(theta, gamma, coeff_x) / perez(0, theta_s, coeff_x)
+	y := zenith_yc * perez(theta, gamma, coeff_yc) / perez(0, theta_s, coeff_yc)
+
+	return xyy_to_rgb(x, y, lum)
+}
+
+// cie xyY to linear srgb
+func xyy_to_rgb(x float64, y float64, lum float64) vec3.Vec3 {
+	if y <= 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+	cx := x * lum / y
+	cz := (1 - x - y) * lum / y
+	return vec3.Vec3{
+		math.Max(0, 3.2406*cx-1.5372*lum-0.4986*cz),
+		math.Max(0, -0.9689*cx+1.8758*lum+0.0415*cz),
+		math.Max(0, 0.0557*cx-0.2040*lum+1.0570*cz),
+	}
+}
+
+// radiance of the sun disk after passing through the atmosphere. rayleigh
+// and aerosol scattering are evaluated at one wavelength per channel
+func (s *Sky) sun() vec3.Vec3 {
+	if s.Sun.Y >= 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+
+	theta := math.Acos(math.Max(-1, math.Min(1, -s.Sun.Y)))
+	// relative optical mass of the air the sunlight passes through
+	mass := 1 / (math.Cos(theta) + 0.15*math.Pow(93.885-theta*180/math.Pi, -1.253))
+	beta := 0.04608*s.Turbidity - 0.04586
+
+	var c [3]float64
+	for i, lambda := range [3]float64{0.68, 0.55, 0.44} {
+		rayleigh := math.Exp(-0.008735 * math.Pow(lambda, -4.08) * mass)
+		aerosol := math.Exp(-beta * math.Pow(lambda, -1.3) * mass)
+		c[i] = sun_luminance * rayleigh * aerosol
+	}
+	return vec3.Vec3{c[0], c[1], c[2]}
+}
+
+func (s *Sky) in_sun(dir vec3.Vec3) bool {
+	return dir.Dot(s.Sun) >= math.Cos(sun_radius)
+}
+
+func (s *Sky) Radiance(dir vec3.Vec3) vec3.Vec3 {
+	dir.Normalize()
+	res := s.dome.Radiance(dir)
+	if s.in_sun(dir) {
+		sun := s.sun_radiance
+		sun.Scale(s.Intensity)
+		res.Add(sun)
+	}
+	return res
+}
+
+func (s *Sky) sun_pdf(dir vec3.Vec3) float64 {
+	if !s.in_sun(dir) {
+		return 0
+	}
+	return 1 / (2 * math.Pi * (1 - math.Cos(sun_radius)))
+}
+
+func (s *Sky) Sample(p vec3.Vec3, u1 float64, u2 float64) (vec3.Vec3, float64, vec3.Vec3, float64) {
+	var dir vec3.Vec3
+	if u1 < s.sun_probability {
+		// uniform within the cone the sun subtends
+		u1 /= s.sun_probability
+		cos_theta := 1 - u1*(1-math.Cos(sun_radius))
+		sin_theta := math.Sqrt(math.Max(0, 1-cos_theta*cos_theta))
+		phi := 2 * math.Pi * u2
+		a, b := object.Basis(s.Sun)
+		a.Scale(sin_theta * math.Cos(phi))
+		b.Scale(sin_theta * math.Sin(phi))
+		dir = s.Sun
+		dir.Scale(cos_theta)
+		dir.Add(a)
+		dir.Add(b)
+	} else {
+		u1 = (u1 - s.sun_probability) / (1 - s.sun_probability)
+		dir, _, _, _ = s.dome.Sample(p, u1, u2)
+	}
+
+	return dir, math.Inf(1), s.Radiance(dir), s.Pdf(p, dir)
+}
+
+func (s *Sky) Pdf(p vec3.Vec3, dir vec3.Vec3) float64 {
+	dir.Normalize()
+	return s.sun_probability*s.sun_pdf(dir) + (1-s.sun_probability)*s.dome.Pdf(p, dir)
+}
+
+func (s *Sky) Power(radius float64) float64 {
+	sun := luminance(s.sun_radiance) * s.Intensity * 2 * math.Pi * (1 - math.Cos(sun_radius))
+	return s.dome.Power(radius) + math.Pi*radius*radius*sun
+}
+
+// the sky is infinitely far away, moving it changes nothing
+func (s *Sky) Transform(t object.Transform) Light {
+	return s
+}
@@ -4,12 +4,21 @@ import (
 	"github.com/supermuesli/pathtracer/vec3"
 	"github.com/supermuesli/pathtracer/object"
 	"github.com/supermuesli/pathtracer/camera"
+	"github.com/supermuesli/pathtracer/scene"
+	"github.com/supermuesli/pathtracer/anim"
+	"github.com/supermuesli/pathtracer/mesh"
+	"github.com/supermuesli/pathtracer/light"
+	"github.com/supermuesli/pathtracer/medium"
+	"github.com/supermuesli/pathtracer/sdf"
+	"github.com/supermuesli/pathtracer/spectrum"
+	"github.com/supermuesli/pathtracer/texture"
 	//"github.com/pkg/profile"
 	"math"
     "sync"
 	"image"
 	"image/color"
 	"image/png"
+	"flag"
 	"log"
 	"os"
 	"fmt"
@@ -21,19 +30,43 @@ import (
 const (
 	window_width = 500
 	window_height = 500
+	frames_per_second = 24.0
+	// alpha masked surfaces a single ray can pass through
+	max_cutouts = 16
+	// distance shadow rays start off the surface
+	shadow_epsilon = 0.01
+	// boundaries of media a single ray can pass through
+	max_crossings = 16
+	// scattering events of a walk through a subsurface material
+	max_walk = 256
 )
 
 var floats []float64
 var float_offset int = -1
 var float_amount int = 100000000
 var inf float64 = math.Inf(1)
-var objects []object.Object
-var spheres []object.Sphere
+// every primitive in the scene, in world space, sorted into a bvh
+var world *object.Bvh
+// light sources and emissive primitives, in world space
+var lights []light.Light
+// picks the light to sample at each bounce
+var light_sampler light.Sampler
+// area lights by object and primitive id, to weight bounces that hit them
+var emitters map[[2]int]light.Light
+// optional light seen by rays that leave the scene
+var environment light.Infinite
+// optional medium filling the scene outside of the interiors of objects,
+// the camera is assumed to be in it
+var global_medium medium.Medium
+// paths carry wavelengths instead of rgb, which glass with an index of
+// refraction that varies with the wavelength needs to split light
+var spectral bool
 var frame_buffer [][]vec3.Vec3
+var frame_time float64
+// camera rays at shutter open and close, interpolated by the time of each ray
 var camera_ray_dir [][]vec3.Vec3
-var cam_x float64
-var cam_y float64
-var cam_z float64
+var camera_ray_dir_close [][]vec3.Vec3
+var camera_origin_close vec3.Vec3
 var zero_vector vec3.Vec3 = vec3.Vec3{0, 0, 0}
 
 // returns the next random float in sequence
@@ -52,70 +85,219 @@ func rand_neg_float() float64 {
 	return res
 }
 
-// takes a ray and checks for intersections among all objects in world space
-// returns color, normal, hit distance and emission
-func trace(ray *object.Line) (vec3.Vec3, vec3.Vec3, float64, float64, (func(vec3.Vec3, vec3.Vec3) vec3.Vec3)) {
-	min_dist := inf
-	closest_hit_color := vec3.Vec3{0, 0, 0}
-	normal := vec3.Vec3{0, 0, 0}
-	emission := 0.0
-	var pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
-
-	for i := 0; i < len(objects); i++ {
-		// iterate through object mesh (triangles)
-		for j := 0; j < len(objects[i].Mesh); j++ {
-			// camera ray
-			intersection, hit_distance := objects[i].Mesh[j].Intersection(ray)
-			if intersection {
-				// only keep the closest intersections
-				if hit_distance < min_dist {
-					min_dist = hit_distance
-					closest_hit_color = objects[i].Mesh[j].Mterial.Diffuse_color
-					normal = surface_normal(&objects[i].Mesh[j])
-					emission = objects[i].Mesh[j].Mterial.Emission
-					pdf = objects[i].Mesh[j].Pdf
-				}
-			}
+// takes a ray and checks for intersections among all primitives in world space
+// returns the closest hit, rec.T is infinite if nothing was hit
+func closest_hit(ray *object.Line) object.HitRecord {
+	rec := object.New_hit_record()
+	rec.Object_id = world.Hit(ray, &rec)
+	return rec
+}
+
+// light arriving at the hit from one of the light sources, weighted by the
+// cosine at the surface. m is the medium on the side the ray came from and
+// w the wavelengths of the path, nil for rgb
+func direct_light(rec *object.HitRecord, incident vec3.Vec3, m medium.Medium, w *spectrum.Wavelengths, time float64) vec3.Vec3 {
+	n := rec.Shading_normal
+
+	// shadow rays start slightly off the surface on the side the ray came
+	// from, they must not find the surface itself
+	offset := rec.Geometric_normal
+	if incident.Dot(offset) > 0 {
+		offset.Scale(-shadow_epsilon)
+	} else {
+		offset.Scale(shadow_epsilon)
+	}
+	origin := rec.Position
+	origin.Add(offset)
+
+	return sample_light(rec.Position, origin, n, m, w, time, func(dir vec3.Vec3) (float64, float64) {
+		cos := dir.Dot(n)
+		if cos <= 0 || dir.Dot(offset) <= 0 {
+			return 0, 0
+		}
+		return cos, cos / math.Pi
+	})
+}
+
+// light arriving at p inside the medium m from one of the light sources,
+// weighted by the phase function of the medium for light travelling along
+// incident
+func medium_light(p vec3.Vec3, incident vec3.Vec3, m medium.Medium, w *spectrum.Wavelengths, time float64) vec3.Vec3 {
+	phase := m.Phase()
+	return sample_light(p, p, zero_vector, m, w, time, func(dir vec3.Vec3) (float64, float64) {
+		f := phase.Eval(incident, dir)
+		return f, f
+	})
+}
+
+// samples the light arriving at p from one light source, picked by the
+// light sampler which favours lights that are bright and close. n is the
+// normal at p, zero inside media, and shadow rays start at origin. scatter
+// returns the weight of light arriving along a direction and the pdf of
+// bouncing into it
+func sample_light(p vec3.Vec3, origin vec3.Vec3, n vec3.Vec3, m medium.Medium, w *spectrum.Wavelengths, time float64, scatter func(vec3.Vec3) (float64, float64)) vec3.Vec3 {
+	l, pmf := light_sampler.Sample(p, n, rand_float())
+	if l == nil || pmf <= 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+
+	dir, dist, li, pdf := l.Sample(p, rand_float(), rand_float())
+	if pdf <= 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+	f, scatter_pdf := scatter(dir)
+	if f <= 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+
+	// the shadow ray finds area lights themselves, only what lies in front
+	// of them casts a shadow
+	if _, ok := l.(*light.Area); ok {
+		dist -= 2 * shadow_epsilon
+	}
+	tr := transmittance(&object.Line{origin, dir, time}, dist, m, w)
+	if tr.Dot(tr) == 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+
+	// bounces may find lights like the environment as well, both
+	// estimates are weighted by how likely they produce the direction
+	weight := 1.0
+	if _, ok := l.(light.Hittable); ok {
+		weight = power_heuristic(pmf*pdf, scatter_pdf)
+	}
+
+	li = w.Emission(li)
+	li.Component_wise_mul(tr)
+	li.Scale(weight * f / (pmf * pdf))
+	return li
+}
+
+// fraction of the light that makes it along the ray over dist, starting in
+// the medium m. rays pass through the boundaries of media, any other
+// surface blocks them
+func transmittance(ray *object.Line, dist float64, m medium.Medium, w *spectrum.Wavelengths) vec3.Vec3 {
+	tr := vec3.Vec3{1, 1, 1}
+	r := *ray
+	for i := 0; i <= max_crossings; i++ {
+		rec := trace(&r)
+		t := math.Min(rec.T, dist)
+		if m != nil {
+			tr.Component_wise_mul(m.Transmittance(r.Origin, r.Dir, t, rand_float))
+		}
+		if rec.T >= dist {
+			return tr
+		}
+		if rec.Mterial.Interior == nil {
+			break
 		}
+
+		// continue behind the boundary
+		m = crossed_medium(&rec, r.Dir, w)
+		dist -= rec.T
+		r.Origin = rec.Position
+	}
+	return vec3.Vec3{0, 0, 0}
+}
+
+// medium a ray travelling along dir is in after crossing the boundary of
+// a medium at rec. boundaries face out of their medium
+func crossed_medium(rec *object.HitRecord, dir vec3.Vec3, w *spectrum.Wavelengths) medium.Medium {
+	if dir.Dot(rec.Geometric_normal) < 0 {
+		return spectral_medium(rec.Mterial.Interior, w)
+	}
+	return spectral_medium(global_medium, w)
+}
+
+// the medium m for paths with the wavelengths w, its coefficients turned
+// into spectra
+func spectral_medium(m medium.Medium, w *spectrum.Wavelengths) medium.Medium {
+	if m == nil || w == nil {
+		return m
+	}
+	return medium.Map_coefficients(m, w.Reflectance)
+}
+
+// follows light that enters a subsurface material at rec through the
+// medium m inside of it. light crosses the surface diffusely in both
+// directions. returns the hit where it leaves the surface again, with the
+// shading normal facing out, and the throughput of the walk. false if the
+// light was absorbed or got lost
+func random_walk(rec *object.HitRecord, incident vec3.Vec3, m medium.Medium, time float64) (object.HitRecord, vec3.Vec3, bool) {
+	weight := vec3.Vec3{1, 1, 1}
+	inward := rec.Geometric_normal
+	if incident.Dot(inward) < 0 {
+		inward.Scale(-1)
 	}
+	// start and leave slightly off the surface, so it isn't found again
+	// right where the walk crosses it
+	origin := inward
+	origin.Scale(shadow_epsilon)
+	origin.Add(rec.Position)
+	ray := object.Line{origin, cosine_direction(inward), time}
+
+	for i := 0; i < max_walk; i++ {
+		exit := trace(&ray)
+		if exit.T == inf {
+			break
+		}
+
+		t, scattered, w := m.Sample(ray.Origin, ray.Dir, exit.T, rand_float)
+		weight.Component_wise_mul(w)
+		if weight.Dot(weight) == 0 {
+			break
+		}
 
-	for i := 0; i < len(spheres); i++ {
-		intersection, hit_distance := spheres[i].Intersection(ray)
-		if intersection {
-			// only keep the closest intersections
-			if hit_distance < min_dist {
-				min_dist = hit_distance
-				closest_hit_color = spheres[i].Mterial.Diffuse_color
-				
-				// compute normal
-				hit_position := ray.Origin
-				d := ray.Dir
-				d.Scale(hit_distance)
-				hit_position.Add(d)
-				normal = hit_position
-				normal.Sub(spheres[i].Origin)
-				// normalize by dividing by radius instead of using Normalize()
-				// much faster :)
-				normal.Scale(1.0/spheres[i].Radius)
-
-				emission = spheres[i].Mterial.Emission
-				pdf = spheres[i].Pdf
+		if !scattered {
+			out := exit.Geometric_normal
+			if ray.Dir.Dot(out) < 0 {
+				out.Scale(-1)
 			}
+			exit.Shading_normal = out
+			out.Scale(shadow_epsilon)
+			exit.Position.Add(out)
+			return exit, weight, true
 		}
+
+		ray.Origin = ray.At(t)
+		ray.Dir, _ = m.Phase().Sample(ray.Dir, rand_float(), rand_float())
 	}
 
-	return closest_hit_color, normal, min_dist, emission, pdf
+	return *rec, vec3.Vec3{0, 0, 0}, false
 }
 
-func surface_normal(tri *object.Triangle) vec3.Vec3 {
-	a := tri.A
-	normal := tri.B
-	c := tri.C
-	normal.Sub(a)
-	c.Sub(a)
-	normal.Cross(c)
-	normal.Normalize()
-	return normal
+// multiple importance sampling weight of a sample with pdf a that could
+// also have been produced with pdf b
+func power_heuristic(a float64, b float64) float64 {
+	if a*a+b*b == 0 {
+		return 0
+	}
+	return a * a / (a*a + b*b)
+}
+
+// like closest_hit, but rays pass through the cut out parts of alpha masked
+// surfaces. fractional alpha lets the ray pass with a probability of
+// 1 - alpha. every ray, shadow rays included, should be traced this way
+func trace(ray *object.Line) object.HitRecord {
+	r := *ray
+	offset := 0.0
+	for i := 0; ; i++ {
+		rec := closest_hit(&r)
+		if rec.T == inf || i == max_cutouts {
+			rec.T += offset
+			return rec
+		}
+
+		alpha := rec.Mterial.Alpha_at(&rec)
+		if alpha >= 1 || alpha > rand_float() {
+			rec.T += offset
+			return rec
+		}
+
+		// continue behind the surface
+		offset += rec.T
+		r.Origin = rec.Position
+	}
 }
 
 func max (a float64, b float64) float64 {
@@ -145,6 +327,41 @@ func cosine_hemisphere_sample() vec3.Vec3 {
     return vec3.Vec3{x, y, math.Sqrt(max(0.0, 1.0 - u1))}
 }
 
+// cosine weighted direction around the unit vector n
+func cosine_direction(n vec3.Vec3) vec3.Vec3 {
+	local := cosine_hemisphere_sample()
+	direction, bitangent := object.Basis(n)
+	direction.Scale(local.X)
+	bitangent.Scale(local.Y)
+	n.Scale(local.Z)
+	direction.Add(bitangent)
+	direction.Add(n)
+
+	return direction
+}
+
+// blends direction towards a random direction in the hemisphere around n,
+// rough surfaces blur their reflections this way
+func roughen(direction vec3.Vec3, n vec3.Vec3, roughness float64) vec3.Vec3 {
+	if roughness <= 0 {
+		return direction
+	}
+
+	scatter := vec3.Vec3{rand_neg_float(), rand_neg_float(), rand_neg_float()}
+	for scatter.Dot(scatter) > 1 || scatter.Dot(n) < 0 {
+		scatter = vec3.Vec3{rand_neg_float(), rand_neg_float(), rand_neg_float()}
+	}
+	scatter.Normalize()
+
+	roughness = min(roughness, 1)
+	direction.Normalize()
+	direction.Scale(1 - roughness)
+	scatter.Scale(roughness)
+	direction.Add(scatter)
+	direction.Normalize()
+	return direction
+}
+
 func save_frame_buffer_to_png(frame_buffer [][]vec3.Vec3, output_name string) {
 	// stores output image
 	img := image.NewNRGBA(image.Rect(0, 0, len(frame_buffer[0]), len(frame_buffer)))
@@ -180,6 +397,16 @@ func save_frame_buffer_to_png(frame_buffer [][]vec3.Vec3, output_name string) {
 func main() {
 	fmt.Println("starty print :)")
 
+	// usage: pathtracer [flags] samples [first_frame last_frame]
+	which_scene := flag.String("scene", "default", "scene to render, default, animated or showcase")
+	sky := flag.Bool("sky", false, "light the scene by a daylight sky through the open front")
+	fog := flag.Bool("fog", false, "fill the scene with fog")
+	flag.BoolVar(&spectral, "spectral", false, "carry wavelengths instead of rgb, glass splits light then")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		log.Fatal("usage: pathtracer [flags] samples [first_frame last_frame]")
+	}
+
 	//
 	// ************************************************************
 	//
@@ -212,25 +439,78 @@ func main() {
 	white_light := object.Material {
 		Diffuse_color : vec3.Vec3{1, 1, 1},
 		Emission      : 17.0,
+		Emission_color: vec3.Vec3{1, 1, 1},
+	}
+
+	// textured materials of the animated scene, textures are looked up at
+	// the uv coordinates or, for solid textures, at the position of each hit
+	checker := object.Material {
+		Diffuse_texture: &texture.Checker {
+			Even: &texture.Constant{vec3.Vec3{0.9, 0.9, 0.9}},
+			Odd: &texture.Constant{vec3.Vec3{0.2, 0.2, 0.6}},
+			Frequency: 4,
+		},
 	}
 
+	marble := object.Material {
+		Diffuse_texture: &texture.Noise {
+			Low: vec3.Vec3{0.3, 0.3, 0.35},
+			High: vec3.Vec3{0.95, 0.95, 0.9},
+			Scale: 80,
+			Octaves: 5,
+			Marble: true,
+		},
+		Roughness: 0.3,
+		// height maps can be procedural too
+		Bump_map: &texture.Noise {
+			High: vec3.Vec3{1, 1, 1},
+			Scale: 15,
+			Octaves: 3,
+		},
+		Bump_scale: 3,
+	}
+
+	// scenes can be lit by an hdr environment map, e.g.
+	//   environment, err = light.Load_environment("studio.hdr", 0, 1)
+	// or by a daylight sky with the sun where it stands at a given time and place, e.g.
+	//   elevation, azimuth := light.Sun_position(time.Now(), 48.1, 11.6)
+	//   environment = light.New_sky(light.Sun_direction(elevation, azimuth), 3, 0.1)
+	// -sky puts the sun low behind the camera, shining into the room
+	if *sky {
+		environment = light.New_sky(light.Sun_direction(0.4, math.Pi), 3, 0.1)
+	}
+
+	// the whole scene can be filled with fog, lamp1 then casts shafts of
+	// light through it, e.g.
+	//   global_medium = &medium.Homogeneous{Absorption: vec3.Vec3{0.0002, 0.0002, 0.0002}, Scattering: vec3.Vec3{0.001, 0.001, 0.001}, G: 0.5}
+	// or hold a cloud of smoke from a density grid, loaded with
+	// medium.Load_grid or made from noise, e.g.
+	//   cloud := &medium.Grid{Min: vec3.Vec3{100, 100, 150}, Max: vec3.Vec3{400, 300, 350}, Width: 96, Height: 64, Depth: 64,
+	//   	Density: medium.Noise_grid(96, 64, 64, 16, 4), Scattering: vec3.Vec3{0.1, 0.1, 0.1}, G: 0.3}
+	//   err = cloud.Prepare()
+	//   global_medium = cloud
+	if *fog {
+		global_medium = &medium.Homogeneous{Absorption: vec3.Vec3{0.0002, 0.0002, 0.0002}, Scattering: vec3.Vec3{0.001, 0.001, 0.001}, G: 0.5}
+	}
+
+	// paths can carry wavelengths instead of rgb with -spectral. it is
+	// slower and noisier, but glass like the prism below splits light into
+	// its colors
+
+	// image textures are loaded from png or jpeg files, e.g.
+	//   img, err := texture.Load_image("wood.jpg", texture.Repeat)
+	// normal and height maps hold data instead of colors, e.g.
+	//   normals, err := texture.Load_data("wood_normal.png", texture.Repeat)
+
 	_ = blue
 	_ = red
 	_ = green
 	_ = purple
 	_ = white
 
+	// cosine weighted, so the albedo alone weights the bounce
 	diffuse_pdf := func(incident vec3.Vec3, n vec3.Vec3) vec3.Vec3 {
-		direction := vec3.Vec3{rand_neg_float(), rand_neg_float(), rand_neg_float()}
-		for {
-			direction.Normalize()
-			if direction.Dot(n) >= 0 {
-				break
-			}
-			direction = vec3.Vec3{rand_neg_float(), rand_neg_float(), rand_neg_float()}
-		}
-
-		return direction
+		return cosine_direction(n)
 	}
 
 	specular_pdf := func(incident vec3.Vec3, n vec3.Vec3) vec3.Vec3 {
@@ -242,158 +522,61 @@ func main() {
 	room_size := 1000.0/2
 
 	// declare objects in 3d space
-	room := object.Object {
-		[](object.Triangle) {
-			// back wall
-			object.Triangle{vec3.Vec3{0, 0, room_size}, vec3.Vec3{0, room_size, room_size}, vec3.Vec3{room_size, room_size, room_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, room_size}, vec3.Vec3{room_size, room_size, room_size}, vec3.Vec3{room_size, 0, room_size}, diffuse_pdf, white},
-			// left wall
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, room_size, 0}, vec3.Vec3{0, room_size, room_size}, diffuse_pdf, green},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, room_size, room_size}, vec3.Vec3{0, 0, room_size}, diffuse_pdf, green},
-			// right wall
-			object.Triangle{vec3.Vec3{room_size, room_size, room_size}, vec3.Vec3{room_size, room_size, 0}, vec3.Vec3{room_size, 0, 0}, diffuse_pdf, red},
-			object.Triangle{vec3.Vec3{room_size, 0, room_size}, vec3.Vec3{room_size, room_size, room_size}, vec3.Vec3{room_size, 0, 0}, diffuse_pdf, red},
-			// ceiling
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, 0, room_size}, vec3.Vec3{room_size, 0, room_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{room_size, 0, room_size}, vec3.Vec3{room_size, 0, 0}, diffuse_pdf, white},
-			// floor
-			object.Triangle{vec3.Vec3{0, room_size, 0}, vec3.Vec3{room_size, room_size, 0}, vec3.Vec3{0, room_size, room_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, room_size, room_size}, vec3.Vec3{room_size, room_size, 0}, vec3.Vec3{room_size, room_size, room_size}, diffuse_pdf, white},
-		},
-	}
+	room := mesh.Cornell_box(room_size, diffuse_pdf, white, green, red)
 
 	cuboid_size := 200.0
 
-	cuboid := object.Object {
-		[](object.Triangle) {
-			// back wall
-			object.Triangle{vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, 0, cuboid_size}, diffuse_pdf, white},
-			// left wall
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{0, 0, cuboid_size}, diffuse_pdf, white},
-			// right wall
-			object.Triangle{vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{cuboid_size, 0, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			// ceiling
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{cuboid_size, 0, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{cuboid_size, 0, cuboid_size}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			// floor
-			object.Triangle{vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			// front plane
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-		},
-	}
+	cuboid := mesh.Box(cuboid_size, cuboid_size, cuboid_size, diffuse_pdf, white)
 
-	cuboid2 := object.Object {
-		[](object.Triangle) {
-			// back wall
-			object.Triangle{vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, 0, cuboid_size}, diffuse_pdf, white},
-			// left wall
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{0, 0, cuboid_size}, diffuse_pdf, white},
-			// right wall
-			object.Triangle{vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{cuboid_size, 0, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			// ceiling
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{cuboid_size, 0, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{cuboid_size, 0, cuboid_size}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			// floor
-			object.Triangle{vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			// front plane
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-		},
-	}
+	// example of how you can move an object: give it a node in the scene graph.
+	// all cuboids share the same mesh, only their transforms differ
+	cuboid_node := scene.New_node("cuboid")
+	cuboid_node.Mesh = &cuboid
+	cuboid_node.Move(100, 150, 300).Rotate_y(0.4).Rotate_x(0.4)
 
-	cuboid3 := object.Object {
-		[](object.Triangle) {
-			// back wall
-			object.Triangle{vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, 0, cuboid_size}, diffuse_pdf, white},
-			// left wall
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{0, 0, cuboid_size}, diffuse_pdf, white},
-			// right wall
-			object.Triangle{vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{cuboid_size, 0, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			// ceiling
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{cuboid_size, 0, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{cuboid_size, 0, cuboid_size}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			// floor
-			object.Triangle{vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			// front plane
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-		},
-	}
-
-	cuboid4 := object.Object {
-		[](object.Triangle) {
-			// back wall
-			object.Triangle{vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, 0, cuboid_size}, diffuse_pdf, white},
-			// left wall
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{0, 0, cuboid_size}, diffuse_pdf, white},
-			// right wall
-			object.Triangle{vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{cuboid_size, 0, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			// ceiling
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, 0, cuboid_size}, vec3.Vec3{cuboid_size, 0, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{cuboid_size, 0, cuboid_size}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-			// floor
-			object.Triangle{vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{0, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, cuboid_size, cuboid_size}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, cuboid_size}, diffuse_pdf, white},
-			// front plane
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, cuboid_size, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, diffuse_pdf, white},
-			object.Triangle{vec3.Vec3{0, 0, 0}, vec3.Vec3{cuboid_size, cuboid_size, 0}, vec3.Vec3{cuboid_size, 0, 0}, diffuse_pdf, white},
-		},
-	}
+	cuboid2_node := scene.New_node("cuboid2")
+	cuboid2_node.Mesh = &cuboid
+	cuboid2_node.Move(1 + cuboid_size, 1 + cuboid_size, 1 + cuboid_size)
 
-	// example of how you can move an object
-	cuboid.Move(100, 150, 300)
-	cuboid.Rotate_y(0.4)
-	cuboid.Rotate_x(0.4)
-	cuboid2.Move(1 + cuboid_size, 1 + cuboid_size, 1 + cuboid_size)
+	cuboid3_node := scene.New_node("cuboid3")
+	cuboid3_node.Mesh = &cuboid
+	cuboid3_node.Move(1 + 1.8*cuboid_size, 1 + 1.6*cuboid_size, 1 + 2*cuboid_size)
+	cuboid3_node.Rotate_x(0.5).Rotate_y(0.3).Rotate_z(0.5)
+	cuboid3_node.Move(430, 270, 20)
 
-	cuboid3.Move(1 + 1.8*cuboid_size, 1 + 1.6*cuboid_size, 1 + 2*cuboid_size)
-	cuboid3.Rotate_x(0.5)
-	cuboid3.Rotate_y(0.3)
-	cuboid3.Rotate_z(0.5)
-	cuboid3.Move(430, 270, 20)
+	// children are placed relative to their parent, so cuboid4 stays stacked
+	// on top of cuboid2 wherever cuboid2 is moved to
+	cuboid4_node := scene.New_node("cuboid4")
+	cuboid4_node.Mesh = &cuboid
+	cuboid4_node.Move(0, -cuboid_size, 0)
+	cuboid2_node.Add(cuboid4_node)
 
 	sphere1 := object.Sphere {
-		vec3.Vec3{150, 150, 250},
-		120.0,
-		specular_pdf,
-		white,
+		Origin: vec3.Vec3{150, 150, 250},
+		Radius: 120.0,
+		Pdf: specular_pdf,
+		Mterial: white,
 	}
 
 	sphere2 := object.Sphere {
-		vec3.Vec3{350, 350, 150},
-		120.0,
-		specular_pdf,
-		white,
+		Origin: vec3.Vec3{350, 350, 150},
+		Radius: 120.0,
+		Pdf: specular_pdf,
+		Mterial: white,
 	}
 
 	sphere3 := object.Sphere {
-		vec3.Vec3{400, 100, 350},
-		90.0,
-		specular_pdf,
-		white,
+		Origin: vec3.Vec3{400, 100, 350},
+		Radius: 90.0,
+		Pdf: specular_pdf,
+		Mterial: white,
 	}
 
 	sphere4 := object.Sphere {
-		vec3.Vec3{150, 350, 300},
-		90.0,
-		specular_pdf,
-		white,
+		Origin: vec3.Vec3{150, 350, 300},
+		Radius: 90.0,
+		Pdf: specular_pdf,
+		Mterial: white,
 	}
 
 	// output dimensions
@@ -405,42 +588,210 @@ func main() {
 		Width: width,
 		Height: height,
 		Origin: vec3.Vec3{float64(width/2), float64(height/2), -float64(width)},
+		Target: vec3.Vec3{float64(width/2), float64(height/2), 0},
+		// the view plane is as far away from the camera as the image is high
+		Fov: 2*math.Atan(float64(width)/float64(2*height)),
+		// 180 degree shutter
+		Shutter_open: 0,
+		Shutter_close: 0.5/frames_per_second,
 	}
 
-	// camera position data: compute this only once
-	cam_x = camera.Origin.X - float64(camera.Width/2)
-	cam_y = camera.Origin.Y - float64(camera.Height/2)
-	cam_z = camera.Origin.Z + float64(camera.Height)
-
 	// define light sources
 	spotlight1_radius := 200.0/2
 
 	depth := height
 
 	lamp1 := object.Object {
-		[]object.Triangle {
+		Mesh: []object.Triangle {
 			object.Triangle {
-				vec3.Vec3{float64(width/2) - float64(spotlight1_radius/2), 0.0000001, float64(depth/2) - float64(spotlight1_radius/2)}, 
-				vec3.Vec3{float64(width/2) + float64(spotlight1_radius/2), 0.0000001, float64(width/2) - float64(spotlight1_radius/2)}, 
-				vec3.Vec3{float64(width/2) - float64(spotlight1_radius/2), 0.0000001, float64(depth/2) + float64(spotlight1_radius/2)}, diffuse_pdf, white_light},
+				A: vec3.Vec3{float64(width/2) - float64(spotlight1_radius/2), 0.0000001, float64(depth/2) - float64(spotlight1_radius/2)}, 
+				B: vec3.Vec3{float64(width/2) + float64(spotlight1_radius/2), 0.0000001, float64(width/2) - float64(spotlight1_radius/2)}, 
+				C: vec3.Vec3{float64(width/2) - float64(spotlight1_radius/2), 0.0000001, float64(depth/2) + float64(spotlight1_radius/2)}, Pdf: diffuse_pdf, Mterial: white_light},
 			object.Triangle {
-				vec3.Vec3{float64(width/2) - float64(spotlight1_radius/2), 0.0000001, float64(depth/2) + float64(spotlight1_radius/2),}, 
-				vec3.Vec3{float64(width/2) + float64(spotlight1_radius/2), 0.0000001, float64(depth/2) - float64(spotlight1_radius/2),}, 
-				vec3.Vec3{float64(width/2) + float64(spotlight1_radius/2), 0.0000001, float64(depth/2) + float64(spotlight1_radius/2)}, diffuse_pdf, white_light},
+				A: vec3.Vec3{float64(width/2) - float64(spotlight1_radius/2), 0.0000001, float64(depth/2) + float64(spotlight1_radius/2),}, 
+				B: vec3.Vec3{float64(width/2) + float64(spotlight1_radius/2), 0.0000001, float64(depth/2) - float64(spotlight1_radius/2),}, 
+				C: vec3.Vec3{float64(width/2) + float64(spotlight1_radius/2), 0.0000001, float64(depth/2) + float64(spotlight1_radius/2)}, Pdf: diffuse_pdf, Mterial: white_light},
 		},
 	}
 
-	_ = cuboid
-	_ = cuboid2
-	_ = cuboid3
-	_ = cuboid4
 	_ = sphere1
 	_ = sphere2
 	_ = sphere3
-
-	objects = append(objects, room, lamp1, cuboid)
-	spheres = append(spheres, sphere4)
-
+	_ = cuboid3_node
+	_ = cuboid2_node
+
+	room_node := scene.New_node("room")
+	room_node.Mesh = &room
+	lamp1_node := scene.New_node("lamp1")
+	lamp1_node.Mesh = &lamp1
+	// analytic primitives go into the scene graph as generic shapes. every
+	// shape type registered with object.Register can be built by its name
+	ring, err := object.New_shape("torus", object.Params{"origin": {0, 0, 0}, "major": {60}, "minor": {15}}, specular_pdf, white)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ring_node := scene.New_node("ring")
+	ring_node.Shape = ring
+	ring_node.Rotate_x(math.Pi/2).Move(250, 380, 150)
+
+	// implicit surfaces are sphere traced and can be combined freely
+	blob_node := scene.New_node("blob")
+	blob_node.Shape = &sdf.Surface {
+		Field: sdf.Smooth_union(
+			sdf.Metaballs([]vec3.Vec3{{-30, 0, 0}, {30, 0, 0}, {0, -35, 0}}, []float64{40, 40, 30}, 20),
+			sdf.Subtraction(sdf.Box(vec3.Vec3{0, 50, 0}, vec3.Vec3{60, 15, 60}), sdf.Sphere(vec3.Vec3{0, 50, 0}, 45)),
+			15,
+		),
+		Box: object.Aabb{vec3.Vec3{-80, -80, -80}, vec3.Vec3{80, 80, 80}},
+		Pdf: diffuse_pdf,
+		Mterial: purple,
+	}
+	blob_node.Move(110, 220, 320)
+
+	// closed shapes can be combined with boolean operations, e.g. a lens
+	// made of two overlapping spheres with a box cut out of its center
+	hole := mesh.Box(40, 40, 200, diffuse_pdf, purple)
+	hole.Move(-20, -20, -100)
+	hole.Update_bounds()
+	lens_node := scene.New_node("lens")
+	lens_node.Shape = &object.Csg {
+		Op: object.Difference,
+		A: &object.Csg {
+			Op: object.Intersection,
+			A: &object.Sphere{Origin: vec3.Vec3{0, 0, -60}, Radius: 100, Pdf: specular_pdf, Mterial: white},
+			B: &object.Sphere{Origin: vec3.Vec3{0, 0, 60}, Radius: 100, Pdf: specular_pdf, Mterial: white},
+		},
+		B: &hole,
+	}
+	lens_node.Move(390, 200, 220)
+
+	// cutouts: a quad with a checkerboard alpha mask looks like a fence,
+	// here in front of the back wall
+	fence_node := scene.New_node("fence")
+	fence_node.Shape = &object.Quad {
+		Corner: vec3.Vec3{0, 0, 0},
+		U: vec3.Vec3{0, 150, 0},
+		V: vec3.Vec3{300, 0, 0},
+		Pdf: diffuse_pdf,
+		Mterial: object.Material {
+			Diffuse_color: vec3.Vec3{0.6, 0.4, 0.2},
+			Alpha: &texture.Checker {
+				Even: &texture.Constant{vec3.Vec3{1, 1, 1}},
+				Odd: &texture.Constant{vec3.Vec3{0, 0, 0}},
+				Frequency: 8,
+			},
+		},
+	}
+	fence_node.Move(100, 349, 470)
+
+	// light sources without geometry. they are placed like any other node
+	// and only light the scene through explicit light sampling
+	spot_node := scene.New_node("spot")
+	spot_node.Light = &light.Spot {
+		Position: vec3.Vec3{0, 0, 0},
+		// straight down onto the floor
+		Direction: vec3.Vec3{0, 1, 0},
+		Color: vec3.Vec3{1, 0.9, 0.7},
+		Intensity: 400000,
+		Inner: 0.3,
+		Outer: 0.5,
+	}
+	spot_node.Move(380, 20, 250)
+
+	// point and spot lights and emissive materials take the intensity
+	// distribution of a real fixture from its ies file, e.g.
+	//   profile, err := ies.Load("downlight.ies")
+	//   spot_node.Light.(*light.Spot).Profile = profile
+	//   white_light.Profile = profile
+
+	// emissive spheres are sampled by the cone of directions they cover, a
+	// small bright bulb stays as cheap to light with as a large one
+	bulb_node := scene.New_node("bulb")
+	bulb_node.Sphere = &object.Sphere {
+		Origin: vec3.Vec3{0, 0, 0},
+		Radius: 8,
+		Pdf: diffuse_pdf,
+		Mterial: object.Material {
+			Diffuse_color: vec3.Vec3{1, 1, 1},
+			Emission: 60,
+			// an incandescent bulb
+			Emission_color: light.Blackbody(2700),
+		},
+	}
+	bulb_node.Move(60, 60, 120)
+
+	// a ball of smoke. its surface only bounds the medium, rays pass
+	// through it and scatter inside
+	smoke_node := scene.New_node("smoke")
+	smoke_node.Sphere = &object.Sphere {
+		Origin: vec3.Vec3{0, 0, 0},
+		Radius: 80,
+		Pdf: diffuse_pdf,
+		Mterial: object.Material {
+			Interior: &medium.Homogeneous {
+				Absorption: vec3.Vec3{0.002, 0.002, 0.002},
+				Scattering: vec3.Vec3{0.05, 0.05, 0.05},
+				G: 0.3,
+			},
+		},
+	}
+	smoke_node.Move(260, 250, 340)
+
+	// a ball of wax, light scatters through it before it leaves again
+	wax_node := scene.New_node("wax")
+	wax_node.Sphere = &object.Sphere {
+		Origin: vec3.Vec3{0, 0, 0},
+		Radius: 60,
+		Pdf: diffuse_pdf,
+		Mterial: object.Material {
+			Subsurface: medium.New_subsurface(medium.Albedo_from_color(vec3.Vec3{0.9, 0.7, 0.5}), vec3.Vec3{8, 5, 3}, 0),
+		},
+	}
+	wax_node.Move(400, 440, 330)
+
+	// a glass prism. flint glass bends blue light more than red, so it
+	// splits white light into a rainbow with -spectral
+	prism := mesh.Prism(120, 100, 160, diffuse_pdf, object.Material {
+		Ior: spectrum.Sf11,
+	})
+	prism_node := scene.New_node("prism")
+	prism_node.Mesh = &prism
+	prism_node.Move(40, 400, 150)
+
+	sphere4_node := scene.New_node("sphere4")
+	sphere4_node.Sphere = &sphere4
+
+	var root *scene.Node
+	camera_track := anim.Camera_track{}
+	switch *which_scene {
+	case "default":
+		root = scene.New_node("root").Add(room_node, lamp1_node, cuboid_node, sphere4_node)
+	case "animated":
+		// the default scene with textured materials, a turntable for the
+		// cuboid, a slow dolly of the camera and a flickering lamp
+		cuboid_node.Mterial = &checker
+		sphere4_node.Mterial = &marble
+
+		cuboid_node.Animation = &anim.Transform_track{}
+		cuboid_node.Animation.Rotation.Add(0, vec3.Vec3{0, 0, 0}, anim.Linear)
+		cuboid_node.Animation.Rotation.Add(4, vec3.Vec3{0, 2*math.Pi, 0}, anim.Linear)
+
+		camera_track.Origin.Add(0, camera.Origin, anim.Bezier)
+		camera_track.Origin.Add(4, vec3.Vec3{camera.Origin.X - 100, camera.Origin.Y, camera.Origin.Z + 200}, anim.Bezier)
+
+		lamp1_node.Intensity = &anim.Track{}
+		lamp1_node.Intensity.Add(0, white_light.Emission, anim.Bezier)
+		lamp1_node.Intensity.Add(2, 0.6*white_light.Emission, anim.Bezier)
+		lamp1_node.Intensity.Add(4, white_light.Emission, anim.Bezier)
+
+		root = scene.New_node("root").Add(room_node, lamp1_node, cuboid_node, sphere4_node)
+	case "showcase":
+		// the other primitives, media and materials, lit by every kind of light
+		root = scene.New_node("root").Add(room_node, lamp1_node, spot_node, bulb_node,
+			ring_node, blob_node, lens_node, fence_node, smoke_node, wax_node, prism_node)
+	default:
+		log.Fatalf("unknown scene %q", *which_scene)
+	}
 
 	// cache random floats for quicker computation
 	floats = make([]float64, float_amount)
@@ -458,38 +809,90 @@ func main() {
 		}
 	}
 
-	// cache camera rays
 	camera_ray_dir = make([][]vec3.Vec3, camera.Width)
-
+	camera_ray_dir_close = make([][]vec3.Vec3, camera.Width)
 	for x := 0; x < camera.Width; x++ {
 		camera_ray_dir[x] = make([]vec3.Vec3, camera.Height)
-
-		for y := 0; y < camera.Height; y++ {
-			// generate camera ray
-			camera_ray_dir[x][y] = vec3.Vec3 {
-				cam_x + float64(x), 
-				cam_y + float64(y), 
-				// camera.Height is 1000, which is also the distance from camera to view plane
-				// TODO find a nicer way to implement this
-				cam_z,
-			}
-
-			camera_ray_dir[x][y].Sub(camera.Origin)
-			camera_ray_dir[x][y].Normalize()
-		}
+		camera_ray_dir_close[x] = make([]vec3.Vec3, camera.Height)
 	}
 	
 	// how many times a single pixel is sampled
-	pixel_samples, _ := strconv.Atoi(string(os.Args[1]))
+	pixel_samples, _ := strconv.Atoi(flag.Arg(0))
 	// how many times a ray bounces
 	hops               := 4
 	
 	// CPU profiling by default
 	//defer profile.Start().Stop()
 
-	render_frame(camera, pixel_samples, hops)
+	// render a single still image at time 0
+	if flag.NArg() < 3 {
+		camera = prepare_frame(root, camera, camera_track, 0)
+		render_frame(camera, pixel_samples, hops)
+
+		save_frame_buffer_to_png(frame_buffer, "output@" + strconv.Itoa(pixel_samples) + "_samples")
+		return
+	}
+
+	// render an image sequence for the given (inclusive) frame range
+	first_frame, _ := strconv.Atoi(flag.Arg(1))
+	last_frame, _ := strconv.Atoi(flag.Arg(2))
+	for frame := first_frame; frame <= last_frame; frame++ {
+		camera = prepare_frame(root, camera, camera_track, float64(frame)/frames_per_second)
+		render_frame(camera, pixel_samples, hops)
+
+		save_frame_buffer_to_png(frame_buffer, fmt.Sprintf("frame_%04d", frame))
+		fmt.Println("rendered frame", frame)
+	}
+}
+
+// builds the scene and the camera rays for the frame starting at the given time
+// and returns the camera at shutter open
+func prepare_frame(root *scene.Node, cam camera.Camera, track anim.Camera_track, time float64) camera.Camera {
+	frame_time = time
+	open := time + cam.Shutter_open
+	close := time + cam.Shutter_close
+
+	// compose world transforms and flatten the scene graph into the bvh
+	world = root.Flatten(open, close)
+	lights = root.Lights(open)
+	if environment != nil {
+		lights = append(lights, environment)
+	}
+	emitters = map[[2]int]light.Light{}
+	for _, l := range light.Emitters(world.Shapes) {
+		lights = append(lights, l)
+		emitters[[2]int{l.Object_id, l.Prim_id}] = l
+	}
+
+	// lights at infinity spread their power over the whole scene
+	bounds := object.Empty_aabb()
+	for _, p := range world.Shapes {
+		b := p.Bounds()
+		if !math.IsInf(b.Min.X+b.Min.Y+b.Min.Z+b.Max.X+b.Max.Y+b.Max.Z, 0) {
+			bounds.Union(b)
+		}
+	}
+	radius := 1.0
+	if bounds.Min.X <= bounds.Max.X {
+		diagonal := bounds.Max
+		diagonal.Sub(bounds.Min)
+		radius = diagonal.Euclidean_norm() / 2
+	}
+	light_sampler = light.New_bvh_sampler(lights, radius)
+
+	cam_close := cam
+	track.Apply(&cam, open)
+	track.Apply(&cam_close, close)
+	camera_origin_close = cam_close.Origin
 
-	save_frame_buffer_to_png(frame_buffer, "output@" + strconv.Itoa(pixel_samples) + "_samples")
+	for x := 0; x < cam.Width; x++ {
+		for y := 0; y < cam.Height; y++ {
+			camera_ray_dir[x][y] = cam.Ray_dir(float64(x), float64(y))
+			camera_ray_dir_close[x][y] = cam_close.Ray_dir(float64(x), float64(y))
+		}
+	}
+
+	return cam
 }
 
 func render_frame_thread(start_x int, end_x int, start_y int, end_y int, camera camera.Camera, samples int, hops int, wg **sync.WaitGroup) {
@@ -503,44 +906,260 @@ func render_frame_thread(start_x int, end_x int, start_y int, end_y int, camera
 			color := zero_vector
 
 			for s := 0; s < samples; s++ {
+				// pick a point in time within the shutter interval and move
+				// the camera there
+				shutter := rand_float()
+				time := frame_time + camera.Shutter_open + shutter*(camera.Shutter_close - camera.Shutter_open)
+
 				origin := camera.Origin
+				origin.Scale(1 - shutter)
+				origin_close := camera_origin_close
+				origin_close.Scale(shutter)
+				origin.Add(origin_close)
+
 				direction := camera_ray_dir[x][y]
-				cur_weight := 0.0
-				cur_color := vec3.Vec3{1.0, 1.0, 1.0}
+				direction.Scale(1 - shutter)
+				direction_close := camera_ray_dir_close[x][y]
+				direction_close.Scale(shutter)
+				direction.Add(direction_close)
+				direction.Normalize()
+
+				// every sample follows its own wavelengths
+				var w *spectrum.Wavelengths
+				if spectral {
+					w = spectrum.Sample_wavelengths(rand_float())
+				}
+
+				// rays through the neighbouring pixels, they tell how large
+				// the pixel is on the textures it hits
+				diff := object.Ray_differential {
+					Valid: true,
+					X_origin: origin,
+					X_dir: camera.Ray_dir(float64(x + 1), float64(y)),
+					Y_origin: origin,
+					Y_dir: camera.Ray_dir(float64(x), float64(y + 1)),
+				}
+
+				// light gathered along the path and the fraction of it that
+				// makes it back to the camera
+				radiance := vec3.Vec3{0, 0, 0}
+				throughput := vec3.Vec3{1.0, 1.0, 1.0}
+				// pdf of the last bounce direction, 0 for camera rays and
+				// mirror reflections which light sampling can't produce
+				bounce_pdf := 0.0
+				// where the last bounce happened, light sampling there
+				// picked lights by this point and normal
+				var prev_position, prev_normal vec3.Vec3
+				// medium the ray travels through and the boundaries of media
+				// it passed, which don't count as bounces
+				current := spectral_medium(global_medium, w)
+				crossings := 0
 				for h := 0; h < hops; h++ {
-					pixel_color, n, distance, emission, pdf := trace(&object.Line{origin, direction})
+					rec := trace(&object.Line{origin, direction, time})
+
+					// media scatter the ray on its way to the surface
+					if current != nil {
+						t, scattered, weight := current.Sample(origin, direction, rec.T, rand_float)
+						throughput.Component_wise_mul(weight)
+						if scattered {
+							incident := direction
+							direction.Scale(t)
+							origin.Add(direction)
+							prev_position, prev_normal = origin, zero_vector
+
+							direct := medium_light(origin, incident, current, w, time)
+							direct.Component_wise_mul(throughput)
+							radiance.Add(direct)
+
+							// the phase function is sampled exactly, its
+							// weight is 1
+							direction, bounce_pdf = current.Phase().Sample(incident, rand_float(), rand_float())
+							diff.Valid = false
+							continue
+						}
+					}
 
 					// no intersection, ray probably left the cornel box
-					if distance == inf {
+					if rec.T == inf {
+						if environment != nil {
+							weight := 1.0
+							if bounce_pdf > 0 {
+								pmf := light_sampler.Pmf(prev_position, prev_normal, environment)
+								weight = power_heuristic(bounce_pdf, pmf*environment.Pdf(origin, direction))
+							}
+							le := w.Emission(environment.Radiance(direction))
+							le.Component_wise_mul(throughput)
+							le.Scale(weight)
+							radiance.Add(le)
+						}
 						break
 					}
 
-					// light attentuation (fall-off)
-					pixel_color.Scale(math.Abs(n.Dot(n)))
-					
-					cur_weight += emission
-					cur_color.Component_wise_mul(pixel_color)
+					// boundaries of media aren't surfaces, rays pass through
+					// them into the medium on the other side
+					if rec.Mterial.Interior != nil {
+						current = crossed_medium(&rec, direction, w)
+						origin = rec.Position
+						if crossings < max_crossings {
+							crossings++
+							h--
+						}
+						continue
+					}
 
-					// hit a light source
+					diff.Footprint(&rec)
+					rec.Mterial.Perturb_normal(&rec)
+					// the back of a surface is lit just like its front
+					rec.Face_forward()
+
+					pixel_color := w.Reflectance(rec.Mterial.Diffuse_at(&rec))
+					n := rec.Shading_normal
+					distance := rec.T
+					emission := rec.Mterial.Emission_at(&rec)
+
+					// hit a light source. light sampling at the last bounce may
+					// have found it too
 					if emission > 0.0 {
+						weight := 1.0
+						if l, ok := emitters[[2]int{rec.Object_id, rec.Prim_id}]; ok && bounce_pdf > 0 {
+							pmf := light_sampler.Pmf(prev_position, prev_normal, l)
+							weight = power_heuristic(bounce_pdf, pmf*l.(light.Hittable).Pdf(prev_position, direction))
+						}
+						// leaves the surface towards where the ray came from
+						out := direction
+						out.Scale(-1)
+						emitted := w.Emission(rec.Mterial.Emitted(&rec, out))
+						emitted.Component_wise_mul(throughput)
+						emitted.Scale(weight)
+						radiance.Add(emitted)
 						break
 					}
 
+					// light entering a subsurface material comes out elsewhere and
+					// leaves the surface like from a lambertian one
+					if rec.Mterial.Subsurface != nil {
+						exit, weight, ok := random_walk(&rec, direction, spectral_medium(rec.Mterial.Subsurface, w), time)
+						if !ok {
+							break
+						}
+						throughput.Component_wise_mul(weight)
+
+						out := exit.Shading_normal
+						inward := out
+						inward.Scale(-1)
+						direct := direct_light(&exit, inward, current, w, time)
+						direct.Component_wise_mul(throughput)
+						direct.Scale(1 / math.Pi)
+						radiance.Add(direct)
+
+						origin = exit.Position
+						direction = cosine_direction(out)
+						prev_position, prev_normal = exit.Position, out
+						bounce_pdf = math.Max(0, direction.Dot(out)) / math.Pi
+						diff.Valid = false
+						continue
+					}
+
+					// glass either reflects or refracts, the fresnel equations
+					// give the probability of each. like mirrors it is only
+					// lit by what bounces find
+					if rec.Mterial.Ior != nil {
+						incident := direction
+						gn := rec.Geometric_normal
+						eta := 1 / w.Ior(rec.Mterial.Ior)
+						if !rec.Front_face {
+							// leaving the glass
+							eta = 1 / eta
+						}
+
+						refracted, ok := object.Refract(incident, gn, eta)
+						if ok && rand_float() >= object.Fresnel(-incident.Dot(gn), eta) {
+							direction = refracted
+							diff.Valid = false
+						} else {
+							direction = object.Reflect(incident, gn)
+							diff.Reflect(&rec, gn)
+						}
+
+						// continue slightly off the surface on the side the
+						// ray leaves to, so it isn't found again
+						offset := gn
+						if direction.Dot(gn) < 0 {
+							offset.Scale(-shadow_epsilon)
+						} else {
+							offset.Scale(shadow_epsilon)
+						}
+						origin = rec.Position
+						origin.Add(offset)
+						prev_position, prev_normal = rec.Position, gn
+						bounce_pdf = 0
+						continue
+					}
+
+					// light attentuation (fall-off)
+					pixel_color.Scale(math.Abs(n.Dot(n)))
+					
+					throughput.Component_wise_mul(pixel_color)
+
 					// bounce
 					// update origin
 					incident := direction
 					direction.Scale(distance)
 					origin.Add(direction)
+					prev_position, prev_normal = rec.Position, n
 
 					// update direction
-					direction = pdf(incident, n)
+					sampled := rec.Pdf(incident, n)
+					roughness := rec.Mterial.Roughness_at(&rec)
+
+					// mirrors only see what lies in the reflected direction,
+					// everything else is lit by the light sources as a
+					// lambertian surface
+					mirrored := object.Reflect(incident, n)
+					mirrored.Sub(sampled)
+					specular := mirrored.Dot(mirrored) < 1e-12
+
+					// roughness blurs mirror reflections. diffuse bounces
+					// already scatter like a diffuse surface and have to stay
+					// cosine weighted, which their weight and pdf assume
+					direction = sampled
+					if specular {
+						direction = roughen(sampled, n, roughness)
+					}
+					if !specular {
+						direct := direct_light(&rec, incident, current, w, time)
+						direct.Component_wise_mul(throughput)
+						direct.Scale(1 / math.Pi)
+						radiance.Add(direct)
+					}
+
+					// shading normals may send rays into the actual surface,
+					// they would leak light through it
+					if direction.Dot(rec.Geometric_normal)*incident.Dot(rec.Geometric_normal) >= 0 {
+						break
+					}
+
+					// only mirror reflections keep the footprint small, after
+					// any other bounce textures are point sampled
+					if specular && roughness == 0 {
+						diff.Reflect(&rec, n)
+					} else {
+						diff.Valid = false
+					}
+
+					// cosine weighted, see diffuse_pdf
+					bounce_pdf = 0
+					if !specular {
+						bounce_pdf = math.Max(0, direction.Dot(n)) / math.Pi
+					}
 				}
 
-				cur_color.Scale(cur_weight)
-				color.Add(cur_color)
+				color.Add(w.To_rgb(radiance))
 			}
 
 			color.Scale(1.0/float64(samples))
+			// spectral samples may come out of the srgb gamut
+			color = vec3.Vec3{max(0, color.X), max(0, color.Y), max(0, color.Z)}
 			frame_buffer[x][y] = color
 
 			// gamma correction
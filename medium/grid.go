@@ -0,0 +1,282 @@
+package medium
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/supermuesli/pathtracer/texture"
+	"github.com/supermuesli/pathtracer/vec3"
+	"io/ioutil"
+	"math"
+)
+
+// medium whose density varies, like smoke or clouds, given by a dense grid
+// of voxels stretched over a box in world space. outside of the box the
+// density is 0. distances are sampled by delta tracking and transmittance
+// is estimated by ratio tracking, both against the largest density
+type Grid struct {
+	// corners of the box in world space
+	Min, Max vec3.Vec3
+	// voxels along x, y and z
+	Width, Height, Depth int
+	// x varies fastest, then y, then z
+	Density []float64
+	// coefficients at a density of 1
+	Absorption, Scattering vec3.Vec3
+	G float64
+	// largest density and the upper bound of the extinction in all
+	// channels, see Prepare
+	max_density, majorant float64
+}
+
+// magic number of grid files
+const grid_magic = "GRID"
+
+// largest width, height or depth of grid files
+const max_grid_side = 1 << 12
+
+// loads a density grid from a file: the four bytes "GRID", the width,
+// height and depth as little endian uint32 and then the densities as
+// little endian float32, x varying fastest
+func Load_grid(path string, min vec3.Vec3, max vec3.Vec3, absorption vec3.Vec3, scattering vec3.Vec3, g float64) (*Grid, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16 || string(data[:4]) != grid_magic {
+		return nil, fmt.Errorf("%s: not a grid file", path)
+	}
+
+	le := binary.LittleEndian
+	w, h, d := le.Uint32(data[4:]), le.Uint32(data[8:]), le.Uint32(data[12:])
+	if w == 0 || h == 0 || d == 0 || w > max_grid_side || h > max_grid_side || d > max_grid_side {
+		return nil, fmt.Errorf("%s: bad grid size %dx%dx%d", path, w, h, d)
+	}
+	// at most 2^36 voxels, this doesn't overflow
+	if int64(w)*int64(h)*int64(d) > int64(len(data)-16)/4 {
+		return nil, fmt.Errorf("%s: truncated grid", path)
+	}
+	n := int(w) * int(h) * int(d)
+
+	density := make([]float64, n)
+	for i := range density {
+		density[i] = float64(math.Float32frombits(le.Uint32(data[16+4*i:])))
+	}
+
+	m := &Grid{Min: min, Max: max, Width: int(w), Height: int(h), Depth: int(d), Density: density,
+		Absorption: absorption, Scattering: scattering, G: g}
+	if err := m.Prepare(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// writes the grid in the format Load_grid reads
+func (m *Grid) Save(path string) error {
+	le := binary.LittleEndian
+	data := make([]byte, 16+4*len(m.Density))
+	copy(data, grid_magic)
+	le.PutUint32(data[4:], uint32(m.Width))
+	le.PutUint32(data[8:], uint32(m.Height))
+	le.PutUint32(data[12:], uint32(m.Depth))
+	for i, v := range m.Density {
+		le.PutUint32(data[16+4*i:], math.Float32bits(float32(v)))
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// cloud of fbm noise with its features scale voxels apart, fading out
+// towards the sides of the grid
+func Noise_grid(width int, height int, depth int, scale float64, octaves int) []float64 {
+	res := make([]float64, width*height*depth)
+	for z := 0; z < depth; z++ {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				p := vec3.Vec3{float64(x) / scale, float64(y) / scale, float64(z) / scale}
+
+				// distance from the center, 1 at the sides
+				c := vec3.Vec3{
+					2*(float64(x)+0.5)/float64(width) - 1,
+					2*(float64(y)+0.5)/float64(height) - 1,
+					2*(float64(z)+0.5)/float64(depth) - 1,
+				}
+				falloff := 1 - c.Euclidean_norm()
+
+				res[(z*height+y)*width+x] = math.Max(0, texture.Fbm(p, octaves)+falloff-0.5)
+			}
+		}
+	}
+	return res
+}
+
+// checks the grid and finds its largest density. call it after changing
+// the grid, Load_grid does already
+func (m *Grid) Prepare() error {
+	if len(m.Density) != m.Width*m.Height*m.Depth || len(m.Density) == 0 {
+		return errors.New("density doesn't match the size of the grid")
+	}
+
+	max := 0.0
+	for _, v := range m.Density {
+		if v < 0 {
+			return errors.New("negative density")
+		}
+		max = math.Max(max, v)
+	}
+	m.max_density = max
+	m.update_majorant()
+	return nil
+}
+
+func (m *Grid) update_majorant() {
+	sigma_t := m.Absorption
+	sigma_t.Add(m.Scattering)
+	m.majorant = m.max_density * math.Max(sigma_t.X, math.Max(sigma_t.Y, sigma_t.Z))
+}
+
+func (m *Grid) voxel(x int, y int, z int) float64 {
+	x = clamp(x, m.Width)
+	y = clamp(y, m.Height)
+	z = clamp(z, m.Depth)
+	return m.Density[(z*m.Height+y)*m.Width+x]
+}
+
+func clamp(i int, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+// density at a point in world space, trilinear between the voxel centers
+func (m *Grid) density_at(p vec3.Vec3) float64 {
+	size := m.Max
+	size.Sub(m.Min)
+	x := (p.X-m.Min.X)/size.X*float64(m.Width) - 0.5
+	y := (p.Y-m.Min.Y)/size.Y*float64(m.Height) - 0.5
+	z := (p.Z-m.Min.Z)/size.Z*float64(m.Depth) - 0.5
+	x0, y0, z0 := math.Floor(x), math.Floor(y), math.Floor(z)
+	fx, fy, fz := x-x0, y-y0, z-z0
+	ix, iy, iz := int(x0), int(y0), int(z0)
+
+	lerp := func(t float64, a float64, b float64) float64 { return a + t*(b-a) }
+	return lerp(fz,
+		lerp(fy, lerp(fx, m.voxel(ix, iy, iz), m.voxel(ix+1, iy, iz)), lerp(fx, m.voxel(ix, iy+1, iz), m.voxel(ix+1, iy+1, iz))),
+		lerp(fy, lerp(fx, m.voxel(ix, iy, iz+1), m.voxel(ix+1, iy, iz+1)), lerp(fx, m.voxel(ix, iy+1, iz+1), m.voxel(ix+1, iy+1, iz+1))))
+}
+
+// part of the ray from origin along dir within [0, t_max] that lies in the box
+func (m *Grid) clip(origin vec3.Vec3, dir vec3.Vec3, t_max float64) (float64, float64, bool) {
+	t0, t1 := 0.0, t_max
+	o := [3]float64{origin.X, origin.Y, origin.Z}
+	d := [3]float64{dir.X, dir.Y, dir.Z}
+	lo := [3]float64{m.Min.X, m.Min.Y, m.Min.Z}
+	hi := [3]float64{m.Max.X, m.Max.Y, m.Max.Z}
+	for i := 0; i < 3; i++ {
+		if d[i] == 0 {
+			if o[i] < lo[i] || o[i] > hi[i] {
+				return 0, 0, false
+			}
+			continue
+		}
+		a, b := (lo[i]-o[i])/d[i], (hi[i]-o[i])/d[i]
+		if a > b {
+			a, b = b, a
+		}
+		t0, t1 = math.Max(t0, a), math.Min(t1, b)
+	}
+	return t0, t1, t0 < t1
+}
+
+func (m *Grid) Sample(origin vec3.Vec3, dir vec3.Vec3, t_max float64, next func() float64) (float64, bool, vec3.Vec3) {
+	weight := vec3.Vec3{1, 1, 1}
+	t, t1, ok := m.clip(origin, dir, t_max)
+	if !ok || m.majorant == 0 {
+		return t_max, false, weight
+	}
+
+	// tentative collisions against the majorant are absorbed, scattered or
+	// null with probabilities by the average of the channels. the weights
+	// make up for the channels the probabilities don't fit
+	for {
+		t -= math.Log(1-next()) / m.majorant
+		if t >= t1 {
+			return t_max, false, weight
+		}
+
+		p := dir
+		p.Scale(t)
+		p.Add(origin)
+		d := m.density_at(p)
+
+		sigma_a := m.Absorption
+		sigma_a.Scale(d)
+		sigma_s := m.Scattering
+		sigma_s.Scale(d)
+		sigma_n := vec3.Vec3{m.majorant, m.majorant, m.majorant}
+		sigma_n.Sub(sigma_a)
+		sigma_n.Sub(sigma_s)
+
+		p_a := average(sigma_a) / m.majorant
+		p_s := average(sigma_s) / m.majorant
+		u := next()
+		if u < p_a {
+			// absorbed, the path carries no more light
+			return t_max, false, vec3.Vec3{0, 0, 0}
+		}
+		if u < p_a+p_s {
+			sigma_s.Scale(1 / (m.majorant * p_s))
+			weight.Component_wise_mul(sigma_s)
+			return t, true, weight
+		}
+		sigma_n.Scale(1 / (m.majorant * (1 - p_a - p_s)))
+		weight.Component_wise_mul(sigma_n)
+	}
+}
+
+func (m *Grid) Transmittance(origin vec3.Vec3, dir vec3.Vec3, t_max float64, next func() float64) vec3.Vec3 {
+	tr := vec3.Vec3{1, 1, 1}
+	t, t1, ok := m.clip(origin, dir, t_max)
+	if !ok || m.majorant == 0 {
+		return tr
+	}
+
+	sigma_t := m.Absorption
+	sigma_t.Add(m.Scattering)
+	for {
+		t -= math.Log(1-next()) / m.majorant
+		if t >= t1 {
+			return tr
+		}
+
+		p := dir
+		p.Scale(t)
+		p.Add(origin)
+		d := m.density_at(p)
+
+		// only the null part of the collision lets light through
+		ratio := sigma_t
+		ratio.Scale(-d / m.majorant)
+		ratio.Add(vec3.Vec3{1, 1, 1})
+		tr.Component_wise_mul(ratio)
+
+		// russian roulette, dense volumes would go on with tiny weights
+		if math.Max(tr.X, math.Max(tr.Y, tr.Z)) < 0.1 {
+			if next() < 0.5 {
+				return vec3.Vec3{0, 0, 0}
+			}
+			tr.Scale(2)
+		}
+	}
+}
+
+func (m *Grid) Phase() Henyey_greenstein {
+	return Henyey_greenstein{m.G}
+}
+
+func average(v vec3.Vec3) float64 {
+	return (v.X + v.Y + v.Z) / 3
+}
@@ -0,0 +1,115 @@
+package medium
+
+import (
+	"encoding/binary"
+	"github.com/supermuesli/pathtracer/vec3"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_grid_round_trip(t *testing.T) {
+	m := &Grid{
+		Min: vec3.Vec3{0, 0, 0}, Max: vec3.Vec3{30, 20, 10},
+		Width: 3, Height: 2, Depth: 2,
+		Density: []float64{0, 0.5, 1, 1.5, 2, 2.5, 3, 3.5, 4, 4.5, 5, 0.25},
+		Absorption: vec3.Vec3{0.1, 0.1, 0.1}, Scattering: vec3.Vec3{0.2, 0.3, 0.4}, G: 0.3,
+	}
+	if err := m.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cloud.grid")
+	if err := m.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Load_grid(path, m.Min, m.Max, m.Absorption, m.Scattering, m.G)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Width != m.Width || res.Height != m.Height || res.Depth != m.Depth {
+		t.Fatalf("size %dx%dx%d, want %dx%dx%d", res.Width, res.Height, res.Depth, m.Width, m.Height, m.Depth)
+	}
+	for i, v := range m.Density {
+		// stored as float32, these are exact
+		if res.Density[i] != v {
+			t.Errorf("density %d is %v, want %v", i, res.Density[i], v)
+		}
+	}
+	if math.Abs(res.majorant-m.majorant) > 1e-12 || m.majorant != 5*0.5 {
+		t.Errorf("majorant %v, want %v", res.majorant, 5*0.5)
+	}
+}
+
+// writes a grid file with the given header and payload
+func write_grid(t *testing.T, magic string, w uint32, h uint32, d uint32, densities ...float32) string {
+	data := make([]byte, 16+4*len(densities))
+	copy(data, magic)
+	le := binary.LittleEndian
+	le.PutUint32(data[4:], w)
+	le.PutUint32(data[8:], h)
+	le.PutUint32(data[12:], d)
+	for i, v := range densities {
+		le.PutUint32(data[16+4*i:], math.Float32bits(v))
+	}
+	path := filepath.Join(t.TempDir(), "test.grid")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func load_error(path string) string {
+	one := vec3.Vec3{1, 1, 1}
+	_, err := Load_grid(path, vec3.Vec3{0, 0, 0}, one, one, one, 0)
+	if err == nil {
+		return ""
+	}
+	return strings.TrimPrefix(err.Error(), path+": ")
+}
+
+func Test_load_grid_header(t *testing.T) {
+	if err := load_error(write_grid(t, "VOXL", 1, 1, 1, 0)); err != "not a grid file" {
+		t.Errorf("wrong magic: got %q", err)
+	}
+
+	short := filepath.Join(t.TempDir(), "short.grid")
+	if err := ioutil.WriteFile(short, []byte("GRID\x01\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := load_error(short); err != "not a grid file" {
+		t.Errorf("short header: got %q", err)
+	}
+
+	if err := load_error(write_grid(t, "GRID", 0, 1, 1)); err != "bad grid size 0x1x1" {
+		t.Errorf("empty grid: got %q", err)
+	}
+	if err := load_error(write_grid(t, "GRID", 1, 1, max_grid_side+1, 0)); err != "bad grid size 1x1x4097" {
+		t.Errorf("deep grid: got %q", err)
+	}
+}
+
+func Test_load_grid_size(t *testing.T) {
+	if err := load_error(write_grid(t, "GRID", 2, 1, 1, 0)); err != "truncated grid" {
+		t.Errorf("one voxel short: got %q", err)
+	}
+
+	// 2^31 * 2^31 voxels took 2^64 bytes, which wrapped around to 0 and
+	// passed as an empty payload
+	if err := load_error(write_grid(t, "GRID", 1<<31, 1<<31, 1)); err != "bad grid size 2147483648x2147483648x1" {
+		t.Errorf("overflowing size: got %q", err)
+	}
+	// as large as it gets, but with no densities
+	if err := load_error(write_grid(t, "GRID", max_grid_side, max_grid_side, max_grid_side, 1)); err != "truncated grid" {
+		t.Errorf("largest size: got %q", err)
+	}
+}
+
+func Test_load_grid_negative(t *testing.T) {
+	if err := load_error(write_grid(t, "GRID", 2, 1, 1, 1, -1)); err != "negative density" {
+		t.Errorf("got %q", err)
+	}
+}
@@ -0,0 +1,213 @@
+package medium
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// participating medium like fog, smoke or murky water. light travelling
+// through it is absorbed and scattered into other directions. coefficients
+// are per world unit and per color channel
+type Medium interface {
+	// samples where a ray from origin along the unit direction dir first
+	// scatters before t_max. returns the distance, whether the ray scatters
+	// there or makes it to t_max, and the weight of the sample, i.e. the
+	// transmittance times the scattering coefficient over the pdf
+	Sample(origin vec3.Vec3, dir vec3.Vec3, t_max float64, next func() float64) (float64, bool, vec3.Vec3)
+	// fraction of light that makes it from origin to t along dir
+	Transmittance(origin vec3.Vec3, dir vec3.Vec3, t float64, next func() float64) vec3.Vec3
+	// distribution of scattered directions
+	Phase() Henyey_greenstein
+}
+
+// medium with the same coefficients everywhere
+type Homogeneous struct {
+	Absorption, Scattering vec3.Vec3
+	// mean cosine of the scattering angle, see Henyey_greenstein
+	G float64
+}
+
+// medium for subsurface scattering. albedo is the fraction of light that
+// is scattered rather than absorbed at each interaction and the mean free
+// path the average distance between interactions, both per channel
+func New_subsurface(albedo vec3.Vec3, mean_free_path vec3.Vec3, g float64) *Homogeneous {
+	m := &Homogeneous{G: g}
+	for i, mfp := range [3]float64{mean_free_path.X, mean_free_path.Y, mean_free_path.Z} {
+		sigma_t := 0.0
+		if mfp > 0 {
+			sigma_t = 1 / mfp
+		}
+		a := channel(albedo, i)
+		set(&m.Scattering, i, a*sigma_t)
+		set(&m.Absorption, i, (1-a)*sigma_t)
+	}
+	return m
+}
+
+// albedo to pass to New_subsurface for a thick piece of material to look
+// like color, after the fit of christensen and burley, "approximate
+// reflectance profiles for efficient subsurface scattering"
+func Albedo_from_color(color vec3.Vec3) vec3.Vec3 {
+	invert := func(a float64) float64 {
+		a = math.Max(0, math.Min(0.999, a))
+		s := 4.09712 + 4.20863*a - math.Sqrt(9.59217+41.6808*a+17.7126*a*a)
+		return 1 - s*s
+	}
+	return vec3.Vec3{invert(color.X), invert(color.Y), invert(color.Z)}
+}
+
+// copy of m with its coefficients passed through f, e.g. to turn them
+// into spectra. media of other types are returned as they are
+func Map_coefficients(m Medium, f func(vec3.Vec3) vec3.Vec3) Medium {
+	switch m := m.(type) {
+	case *Homogeneous:
+		res := *m
+		res.Absorption, res.Scattering = f(m.Absorption), f(m.Scattering)
+		return &res
+	case *Grid:
+		// shares the densities
+		res := *m
+		res.Absorption, res.Scattering = f(m.Absorption), f(m.Scattering)
+		res.update_majorant()
+		return &res
+	}
+	return m
+}
+
+func set(v *vec3.Vec3, i int, x float64) {
+	switch i {
+	case 0:
+		v.X = x
+	case 1:
+		v.Y = x
+	default:
+		v.Z = x
+	}
+}
+
+func exp(v vec3.Vec3) vec3.Vec3 {
+	return vec3.Vec3{math.Exp(v.X), math.Exp(v.Y), math.Exp(v.Z)}
+}
+
+func channel(v vec3.Vec3, i int) float64 {
+	switch i {
+	case 0:
+		return v.X
+	case 1:
+		return v.Y
+	}
+	return v.Z
+}
+
+func (m *Homogeneous) extinction() vec3.Vec3 {
+	res := m.Absorption
+	res.Add(m.Scattering)
+	return res
+}
+
+func (m *Homogeneous) Sample(origin vec3.Vec3, dir vec3.Vec3, t_max float64, next func() float64) (float64, bool, vec3.Vec3) {
+	sigma_t := m.extinction()
+
+	// distances are sampled by the extinction of a random channel, the pdf
+	// is the average over all channels
+	t := math.Inf(1)
+	if s := channel(sigma_t, int(math.Min(next()*3, 2))); s > 0 {
+		t = -math.Log(1-next()) / s
+	}
+
+	scattered := t < t_max
+	if !scattered {
+		t = t_max
+	}
+	tr := sigma_t
+	tr.Scale(-t)
+	tr = exp(tr)
+
+	var pdf float64
+	weight := tr
+	if scattered {
+		density := tr
+		density.Component_wise_mul(sigma_t)
+		pdf = average(density)
+		weight.Component_wise_mul(m.Scattering)
+	} else {
+		pdf = average(tr)
+	}
+
+	if pdf == 0 {
+		return t, scattered, vec3.Vec3{0, 0, 0}
+	}
+	weight.Scale(1 / pdf)
+	return t, scattered, weight
+}
+
+func (m *Homogeneous) Transmittance(origin vec3.Vec3, dir vec3.Vec3, t float64, next func() float64) vec3.Vec3 {
+	sigma_t := m.extinction()
+	// only infinite where nothing is in the way
+	if math.IsInf(t, 1) {
+		return vec3.Vec3{zero_if_positive(sigma_t.X), zero_if_positive(sigma_t.Y), zero_if_positive(sigma_t.Z)}
+	}
+	sigma_t.Scale(-t)
+	return exp(sigma_t)
+}
+
+func zero_if_positive(x float64) float64 {
+	if x > 0 {
+		return 0
+	}
+	return 1
+}
+
+func (m *Homogeneous) Phase() Henyey_greenstein {
+	return Henyey_greenstein{m.G}
+}
+
+// phase function with a single parameter g, the mean cosine of the
+// scattering angle. 0 scatters evenly in all directions, values towards 1
+// mostly forward and towards -1 mostly back
+type Henyey_greenstein struct {
+	G float64
+}
+
+// density of scattering into the unit direction out of light travelling
+// along the unit direction in
+func (p Henyey_greenstein) Eval(in vec3.Vec3, out vec3.Vec3) float64 {
+	g := p.G
+	denom := 1 + g*g - 2*g*in.Dot(out)
+	return (1 - g*g) / (4 * math.Pi * denom * math.Sqrt(math.Max(denom, 1e-12)))
+}
+
+// samples the direction light travelling along in scatters into, returns
+// it and its pdf
+func (p Henyey_greenstein) Sample(in vec3.Vec3, u1 float64, u2 float64) (vec3.Vec3, float64) {
+	g := p.G
+	var cos float64
+	if math.Abs(g) < 1e-3 {
+		cos = 1 - 2*u1
+	} else {
+		s := (1 - g*g) / (1 - g + 2*g*u1)
+		cos = (1 + g*g - s*s) / (2 * g)
+	}
+	cos = math.Max(-1, math.Min(1, cos))
+	sin := math.Sqrt(math.Max(0, 1-cos*cos))
+	phi := 2 * math.Pi * u2
+
+	a, b := basis(in)
+	a.Scale(sin * math.Cos(phi))
+	b.Scale(sin * math.Sin(phi))
+	out := in
+	out.Scale(cos)
+	out.Add(a)
+	out.Add(b)
+	out.Normalize()
+	return out, p.Eval(in, out)
+}
+
+// orthonormal vectors perpendicular to the unit vector n, the same as
+// object.Basis which the objects' materials keep this package from importing
+func basis(n vec3.Vec3) (vec3.Vec3, vec3.Vec3) {
+	sign := math.Copysign(1, n.Z)
+	a := -1 / (sign + n.Z)
+	b := n.X * n.Y * a
+	return vec3.Vec3{1 + sign*n.X*n.X*a, sign * b, -sign * n.X}, vec3.Vec3{b, sign + n.Y*n.Y*a, -n.Y}
+}
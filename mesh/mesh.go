@@ -0,0 +1,308 @@
+package mesh
+
+import (
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// generators for common solids. all meshes are wound so that the face
+// normals point outwards, come with texture coordinates and, for curved
+// surfaces, with smooth vertex normals
+
+type pdf_func = func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+
+// parameterized surface, maps u, v in [0, 1] to a point and its normal
+type surface func(u float64, v float64) (vec3.Vec3, vec3.Vec3)
+
+// builds a triangle and flips its winding if it disagrees with the given
+// vertex normals. returns false for degenerate triangles, e.g. at poles
+func triangle(p [3]vec3.Vec3, n [3]vec3.Vec3, uv [3][2]float64, pdf pdf_func, mat object.Material) (object.Triangle, bool) {
+	t := object.Triangle{A: p[0], B: p[1], C: p[2], Pdf: pdf, Mterial: mat}
+	if t.Area() < 1e-12 {
+		return t, false
+	}
+
+	avg := n[0]
+	avg.Add(n[1])
+	avg.Add(n[2])
+	if t.Face_normal().Dot(avg) < 0 {
+		t.B, t.C = t.C, t.B
+		n[1], n[2] = n[2], n[1]
+		uv[1], uv[2] = uv[2], uv[1]
+	}
+
+	t.Normals = &n
+	t.Uvs = &uv
+	return t, true
+}
+
+// tessellates a parameterized surface into cols x rows cells
+func grid(cols int, rows int, f surface, pdf pdf_func, mat object.Material) []object.Triangle {
+	var tris []object.Triangle
+	for i := 0; i < cols; i++ {
+		for j := 0; j < rows; j++ {
+			u0, u1 := float64(i)/float64(cols), float64(i+1)/float64(cols)
+			v0, v1 := float64(j)/float64(rows), float64(j+1)/float64(rows)
+
+			var p [4]vec3.Vec3
+			var n [4]vec3.Vec3
+			uv := [4][2]float64{{u0, v0}, {u1, v0}, {u1, v1}, {u0, v1}}
+			for k := 0; k < 4; k++ {
+				p[k], n[k] = f(uv[k][0], uv[k][1])
+			}
+
+			for _, idx := range [2][3]int{{0, 1, 2}, {0, 2, 3}} {
+				t, ok := triangle(
+					[3]vec3.Vec3{p[idx[0]], p[idx[1]], p[idx[2]]},
+					[3]vec3.Vec3{n[idx[0]], n[idx[1]], n[idx[2]]},
+					[3][2]float64{uv[idx[0]], uv[idx[1]], uv[idx[2]]},
+					pdf, mat)
+				if ok {
+					tris = append(tris, t)
+				}
+			}
+		}
+	}
+
+	return tris
+}
+
+// flat parallelogram spanned by u and v at corner, facing u x v
+func quad(corner vec3.Vec3, u vec3.Vec3, v vec3.Vec3, pdf pdf_func, mat object.Material) []object.Triangle {
+	n := u
+	n.Cross(v)
+	n.Normalize()
+	return grid(1, 1, func(a float64, b float64) (vec3.Vec3, vec3.Vec3) {
+		p := corner
+		du := u
+		du.Scale(a)
+		dv := v
+		dv.Scale(b)
+		p.Add(du)
+		p.Add(dv)
+		return p, n
+	}, pdf, mat)
+}
+
+// horizontal disk at height y, facing +y or -y
+func disk(radius float64, y float64, normal_y float64, segments int, pdf pdf_func, mat object.Material) []object.Triangle {
+	n := vec3.Vec3{0, normal_y, 0}
+	return grid(segments, 1, func(u float64, v float64) (vec3.Vec3, vec3.Vec3) {
+		phi := 2 * math.Pi * u
+		return vec3.Vec3{v * radius * math.Cos(phi), y, v * radius * math.Sin(phi)}, n
+	}, pdf, mat)
+}
+
+// box from (0, 0, 0) to (width, height, depth), just like the hand written
+// cuboids used to be
+func Box(width float64, height float64, depth float64, pdf pdf_func, mat object.Material) object.Object {
+	var tris []object.Triangle
+	for _, face := range box_faces(width, height, depth) {
+		tris = append(tris, quad(face[0], face[1], face[2], pdf, mat)...)
+	}
+
+	return object.Object{Mesh: tris}
+}
+
+// corner and edges of the six faces of a box, with edge1 x edge2 pointing outwards.
+// the order is left, right, ceiling, floor, front, back
+func box_faces(w float64, h float64, d float64) [6][3]vec3.Vec3 {
+	return [6][3]vec3.Vec3{
+		{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, 0, d}, vec3.Vec3{0, h, 0}},
+		{vec3.Vec3{w, 0, 0}, vec3.Vec3{0, h, 0}, vec3.Vec3{0, 0, d}},
+		{vec3.Vec3{0, 0, 0}, vec3.Vec3{w, 0, 0}, vec3.Vec3{0, 0, d}},
+		{vec3.Vec3{0, h, 0}, vec3.Vec3{0, 0, d}, vec3.Vec3{w, 0, 0}},
+		{vec3.Vec3{0, 0, 0}, vec3.Vec3{0, h, 0}, vec3.Vec3{w, 0, 0}},
+		{vec3.Vec3{0, 0, d}, vec3.Vec3{w, 0, 0}, vec3.Vec3{0, h, 0}},
+	}
+}
+
+// sphere around the origin made of slices around the y axis and stacks
+// from pole to pole
+func Uv_sphere(radius float64, slices int, stacks int, pdf pdf_func, mat object.Material) object.Object {
+	return object.Object{Mesh: grid(slices, stacks, func(u float64, v float64) (vec3.Vec3, vec3.Vec3) {
+		phi := 2 * math.Pi * u
+		theta := math.Pi * v
+		n := vec3.Vec3{math.Sin(theta) * math.Cos(phi), math.Cos(theta), math.Sin(theta) * math.Sin(phi)}
+		p := n
+		p.Scale(radius)
+		return p, n
+	}, pdf, mat)}
+}
+
+// sphere around the origin made by repeatedly subdividing an icosahedron.
+// its triangles are much more even than those of a uv sphere
+func Icosphere(radius float64, subdivisions int, pdf pdf_func, mat object.Material) object.Object {
+	g := (1 + math.Sqrt(5)) / 2
+	verts := []vec3.Vec3{
+		{-1, g, 0}, {1, g, 0}, {-1, -g, 0}, {1, -g, 0},
+		{0, -1, g}, {0, 1, g}, {0, -1, -g}, {0, 1, -g},
+		{g, 0, -1}, {g, 0, 1}, {-g, 0, -1}, {-g, 0, 1},
+	}
+	for i := range verts {
+		verts[i].Normalize()
+	}
+
+	faces := [][3]int{
+		{0, 11, 5}, {0, 5, 1}, {0, 1, 7}, {0, 7, 10}, {0, 10, 11},
+		{1, 5, 9}, {5, 11, 4}, {11, 10, 2}, {10, 7, 6}, {7, 1, 8},
+		{3, 9, 4}, {3, 4, 2}, {3, 2, 6}, {3, 6, 8}, {3, 8, 9},
+		{4, 9, 5}, {2, 4, 11}, {6, 2, 10}, {8, 6, 7}, {9, 8, 1},
+	}
+
+	for s := 0; s < subdivisions; s++ {
+		// shared edges must share their midpoint, otherwise the mesh cracks
+		midpoints := map[[2]int]int{}
+		midpoint := func(a int, b int) int {
+			if a > b {
+				a, b = b, a
+			}
+			if m, ok := midpoints[[2]int{a, b}]; ok {
+				return m
+			}
+			m := verts[a]
+			m.Add(verts[b])
+			m.Normalize()
+			verts = append(verts, m)
+			midpoints[[2]int{a, b}] = len(verts) - 1
+			return len(verts) - 1
+		}
+
+		var next [][3]int
+		for _, f := range faces {
+			ab, bc, ca := midpoint(f[0], f[1]), midpoint(f[1], f[2]), midpoint(f[2], f[0])
+			next = append(next, [3]int{f[0], ab, ca}, [3]int{f[1], bc, ab}, [3]int{f[2], ca, bc}, [3]int{ab, bc, ca})
+		}
+		faces = next
+	}
+
+	// spherical texture coordinates
+	uv := func(n vec3.Vec3) [2]float64 {
+		phi := math.Atan2(n.Z, n.X)
+		if phi < 0 {
+			phi += 2 * math.Pi
+		}
+		return [2]float64{phi / (2 * math.Pi), math.Acos(math.Max(-1, math.Min(1, n.Y))) / math.Pi}
+	}
+
+	var tris []object.Triangle
+	for _, f := range faces {
+		var p, n [3]vec3.Vec3
+		var uvs [3][2]float64
+		for k := 0; k < 3; k++ {
+			n[k] = verts[f[k]]
+			p[k] = n[k]
+			p[k].Scale(radius)
+			uvs[k] = uv(n[k])
+		}
+		if t, ok := triangle(p, n, uvs, pdf, mat); ok {
+			tris = append(tris, t)
+		}
+	}
+
+	return object.Object{Mesh: tris}
+}
+
+// capped cylinder from the origin along the y axis, matching object.Cylinder
+func Cylinder(radius float64, height float64, segments int, pdf pdf_func, mat object.Material) object.Object {
+	tris := grid(segments, 1, func(u float64, v float64) (vec3.Vec3, vec3.Vec3) {
+		phi := 2 * math.Pi * u
+		n := vec3.Vec3{math.Cos(phi), 0, math.Sin(phi)}
+		return vec3.Vec3{radius * n.X, height * v, radius * n.Z}, n
+	}, pdf, mat)
+	tris = append(tris, disk(radius, 0, -1, segments, pdf, mat)...)
+	tris = append(tris, disk(radius, height, 1, segments, pdf, mat)...)
+	return object.Object{Mesh: tris}
+}
+
+// capped cone with its base at the origin and its apex on the y axis,
+// matching object.Cone
+func Cone(radius float64, height float64, segments int, pdf pdf_func, mat object.Material) object.Object {
+	tris := grid(segments, 1, func(u float64, v float64) (vec3.Vec3, vec3.Vec3) {
+		phi := 2 * math.Pi * u
+		n := vec3.Vec3{height * math.Cos(phi), radius, height * math.Sin(phi)}
+		n.Normalize()
+		r := (1 - v) * radius
+		return vec3.Vec3{r * math.Cos(phi), height * v, r * math.Sin(phi)}, n
+	}, pdf, mat)
+	tris = append(tris, disk(radius, 0, -1, segments, pdf, mat)...)
+	return object.Object{Mesh: tris}
+}
+
+// triangular prism in the box from (0, 0, 0) to (width, height, depth),
+// its edges along the z axis. the apex is at y = 0, which is up in our
+// scenes, and the base at y = height
+func Prism(width float64, height float64, depth float64, pdf pdf_func, mat object.Material) object.Object {
+	a := vec3.Vec3{0, height, 0}
+	b := vec3.Vec3{width, height, 0}
+	c := vec3.Vec3{width / 2, 0, 0}
+	along := vec3.Vec3{0, 0, depth}
+
+	ac := c
+	ac.Sub(a)
+	bc := c
+	bc.Sub(b)
+	var tris []object.Triangle
+	tris = append(tris, quad(a, along, vec3.Vec3{width, 0, 0}, pdf, mat)...)
+	tris = append(tris, quad(a, ac, along, pdf, mat)...)
+	tris = append(tris, quad(b, along, bc, pdf, mat)...)
+
+	// caps at both ends
+	uv := [3][2]float64{{0, 1}, {1, 1}, {0.5, 0}}
+	for _, z := range []float64{0, depth} {
+		n := vec3.Vec3{0, 0, 1}
+		if z == 0 {
+			n.Z = -1
+		}
+		p := [3]vec3.Vec3{a, b, c}
+		for i := range p {
+			p[i].Z = z
+		}
+		if t, ok := triangle(p, [3]vec3.Vec3{n, n, n}, uv, pdf, mat); ok {
+			tris = append(tris, t)
+		}
+	}
+
+	return object.Object{Mesh: tris}
+}
+
+// torus around the y axis through the origin, matching object.Torus
+func Torus(major float64, minor float64, segments int, sides int, pdf pdf_func, mat object.Material) object.Object {
+	return object.Object{Mesh: grid(segments, sides, func(u float64, v float64) (vec3.Vec3, vec3.Vec3) {
+		phi := 2 * math.Pi * u
+		theta := 2 * math.Pi * v
+		n := vec3.Vec3{math.Cos(theta) * math.Cos(phi), math.Sin(theta), math.Cos(theta) * math.Sin(phi)}
+		ring := major + minor*math.Cos(theta)
+		return vec3.Vec3{ring * math.Cos(phi), minor * math.Sin(theta), ring * math.Sin(phi)}, n
+	}, pdf, mat)}
+}
+
+// flat grid of cols x rows cells in the xz plane centered at the origin.
+// it faces -y, which is up in our scenes
+func Plane_grid(width float64, depth float64, cols int, rows int, pdf pdf_func, mat object.Material) object.Object {
+	n := vec3.Vec3{0, -1, 0}
+	return object.Object{Mesh: grid(cols, rows, func(u float64, v float64) (vec3.Vec3, vec3.Vec3) {
+		return vec3.Vec3{(u - 0.5) * width, 0, (v - 0.5) * depth}, n
+	}, pdf, mat)}
+}
+
+// cornell box room from (0, 0, 0) to (size, size, size) with the front
+// (z = 0) left open for the camera. all walls face inwards. left is the
+// x = 0 wall, the ceiling is at y = 0
+func Cornell_box(size float64, pdf pdf_func, walls object.Material, left object.Material, right object.Material) object.Object {
+	faces := box_faces(size, size, size)
+	mats := [6]object.Material{left, right, walls, walls, walls, walls}
+
+	var tris []object.Triangle
+	for i, face := range faces {
+		// open front
+		if i == 4 {
+			continue
+		}
+		// swapping the edges flips the face inwards
+		tris = append(tris, quad(face[0], face[2], face[1], pdf, mats[i])...)
+	}
+
+	return object.Object{Mesh: tris}
+}
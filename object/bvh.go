@@ -0,0 +1,152 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"sort"
+)
+
+type bvh_node struct {
+	box Aabb
+	// children, or -1 for leaves
+	left, right int
+	// index of the shape of a leaf
+	shape int
+}
+
+// bounding volume hierarchy over shapes. rays only test the shapes whose
+// boxes they pass through, so they cost a few steps down the tree instead
+// of one test per shape
+type Bvh struct {
+	Shapes []Shape
+	nodes []bvh_node
+	// shapes without finite bounds, like planes, which every ray tests
+	unbounded []int
+}
+
+// builds the tree over shapes, which must not change afterwards. moving
+// shapes have to bound their whole motion
+func New_bvh(shapes []Shape) *Bvh {
+	b := &Bvh{Shapes: shapes}
+
+	var bounded []int
+	for i, s := range shapes {
+		box := s.Bounds()
+		if finite(box.Min) && finite(box.Max) {
+			bounded = append(bounded, i)
+		} else {
+			b.unbounded = append(b.unbounded, i)
+		}
+	}
+
+	if len(bounded) > 0 {
+		b.build(bounded)
+	}
+	return b
+}
+
+func finite(p vec3.Vec3) bool {
+	return !math.IsInf(p.X+p.Y+p.Z, 0) && !math.IsNaN(p.X+p.Y+p.Z)
+}
+
+// builds the subtree over the shapes with the given indices and returns
+// its index
+func (b *Bvh) build(shapes []int) int {
+	idx := len(b.nodes)
+	b.nodes = append(b.nodes, bvh_node{left: -1, right: -1, shape: -1})
+
+	if len(shapes) == 1 {
+		b.nodes[idx].box = b.Shapes[shapes[0]].Bounds()
+		b.nodes[idx].shape = shapes[0]
+		return idx
+	}
+
+	// split at the median along the longest axis of the centers
+	centers := Empty_aabb()
+	for _, i := range shapes {
+		centers.Extend(b.center(i))
+	}
+	extent := centers.Max
+	extent.Sub(centers.Min)
+	axis := func(p vec3.Vec3) float64 { return p.X }
+	if extent.Y > extent.X && extent.Y > extent.Z {
+		axis = func(p vec3.Vec3) float64 { return p.Y }
+	} else if extent.Z > extent.X {
+		axis = func(p vec3.Vec3) float64 { return p.Z }
+	}
+	sort.Slice(shapes, func(i, j int) bool { return axis(b.center(shapes[i])) < axis(b.center(shapes[j])) })
+
+	mid := len(shapes) / 2
+	left := b.build(shapes[:mid])
+	right := b.build(shapes[mid:])
+
+	box := b.nodes[left].box
+	box.Union(b.nodes[right].box)
+	b.nodes[idx].box = box
+	b.nodes[idx].left, b.nodes[idx].right = left, right
+	return idx
+}
+
+func (b *Bvh) center(i int) vec3.Vec3 {
+	box := b.Shapes[i].Bounds()
+	c := box.Min
+	c.Add(box.Max)
+	c.Scale(0.5)
+	return c
+}
+
+// like Shape.Hit, keeps the closest hit in rec. returns the index of the
+// shape that was hit, -1 if none was hit closer than rec.T
+func (b *Bvh) Hit(ray *Line, rec *HitRecord) int {
+	hit := -1
+	for _, i := range b.unbounded {
+		if b.Shapes[i].Hit(ray, rec) {
+			hit = i
+		}
+	}
+	if len(b.nodes) == 0 {
+		return hit
+	}
+
+	// nodes still to visit and where the ray enters them. the nearer child
+	// of a node is visited first, so the farther one can often be skipped
+	var stack [64]int
+	var entry [64]float64
+	n := 0
+	if t, _, ok := b.nodes[0].box.Range(ray); ok {
+		stack[0], entry[0], n = 0, t, 1
+	}
+	for n > 0 {
+		n--
+		if entry[n] > rec.T {
+			continue
+		}
+		node := &b.nodes[stack[n]]
+
+		if node.left < 0 {
+			if b.Shapes[node.shape].Hit(ray, rec) {
+				hit = node.shape
+			}
+			continue
+		}
+
+		t_left, _, ok_left := b.nodes[node.left].box.Range(ray)
+		t_right, _, ok_right := b.nodes[node.right].box.Range(ray)
+		if ok_left && ok_right && t_left < t_right {
+			stack[n], entry[n] = node.right, t_right
+			stack[n+1], entry[n+1] = node.left, t_left
+			n += 2
+			continue
+		}
+		if ok_left {
+			stack[n], entry[n] = node.left, t_left
+			n++
+		}
+		if ok_right {
+			stack[n], entry[n] = node.right, t_right
+			n++
+		}
+	}
+
+	return hit
+}
@@ -0,0 +1,58 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func Test_bvh_matches_linear_scan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var shapes []Shape
+	for i := 0; i < 200; i++ {
+		shapes = append(shapes, &Sphere{
+			Origin: vec3.Vec3{rng.Float64() * 100, rng.Float64() * 100, rng.Float64() * 100},
+			Radius: 1 + rng.Float64()*4,
+		})
+	}
+	// unbounded shapes are tested by every ray
+	shapes = append(shapes, &Plane{Point: vec3.Vec3{0, -10, 0}, Normal: vec3.Vec3{0, 1, 0}})
+	bvh := New_bvh(shapes)
+
+	for i := 0; i < 2000; i++ {
+		dir := vec3.Vec3{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}
+		dir.Normalize()
+		ray := Line{vec3.Vec3{rng.Float64() * 100, rng.Float64() * 100, rng.Float64() * 100}, dir, 0}
+
+		want := New_hit_record()
+		want_id := -1
+		for j, s := range shapes {
+			if s.Hit(&ray, &want) {
+				want_id = j
+			}
+		}
+
+		rec := New_hit_record()
+		if id := bvh.Hit(&ray, &rec); id != want_id || rec.T != want.T {
+			t.Fatalf("ray %d hit shape %d at %v, want shape %d at %v", i, id, rec.T, want_id, want.T)
+		}
+	}
+}
+
+func Test_mesh_bvh_prim_id(t *testing.T) {
+	// two triangles side by side, facing down the z axis
+	o := Object{Mesh: []Triangle{
+		{A: vec3.Vec3{0, 0, 0}, B: vec3.Vec3{1, 0, 0}, C: vec3.Vec3{0, 1, 0}},
+		{A: vec3.Vec3{5, 0, 0}, B: vec3.Vec3{6, 0, 0}, C: vec3.Vec3{5, 1, 0}},
+	}}
+	o.Update_bounds()
+
+	rec := New_hit_record()
+	if !o.Hit(&Line{vec3.Vec3{5.2, 0.2, -1}, vec3.Vec3{0, 0, 1}, 0}, &rec) {
+		t.Fatal("missed the second triangle")
+	}
+	if rec.Prim_id != 1 || math.Abs(rec.T-1) > 1e-12 {
+		t.Errorf("hit triangle %d at %v, want triangle 1 at 1", rec.Prim_id, rec.T)
+	}
+}
@@ -0,0 +1,205 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"sort"
+)
+
+// upper bound on the number of surfaces the generic interval search crosses
+const max_boundaries = 64
+
+// stretch of a ray inside a closed shape. the distances in the records
+// may be negative if the ray starts inside the shape
+type Interval struct {
+	Enter, Exit HitRecord
+}
+
+// closed shapes that can report their intervals along a ray directly. all
+// other closed shapes are handled by walking from surface to surface
+type Solid interface {
+	Intervals(ray *Line) []Interval
+}
+
+// returns all intervals of the whole line through ray that lie inside the
+// closed shape s, ordered by distance. s is assumed to be closed and to
+// have outward facing normals
+func Intervals(s Shape, ray *Line) []Interval {
+	if solid, ok := s.(Solid); ok {
+		return solid.Intervals(ray)
+	}
+
+	// start the walk in front of the bounds, so that intervals behind the
+	// origin of the ray are found as well
+	box := s.Bounds()
+	center := box.Min
+	center.Add(box.Max)
+	center.Scale(0.5)
+	extent := box.Max
+	extent.Sub(box.Min)
+	to_center := ray.Origin
+	to_center.Sub(center)
+	t := -(to_center.Euclidean_norm()+extent.Euclidean_norm())/ray.Dir.Euclidean_norm() - 1
+	if math.IsInf(t, 0) || math.IsNaN(t) {
+		t = 0
+	}
+
+	var res []Interval
+	var enter *HitRecord
+	for i := 0; i < max_boundaries; i++ {
+		r := Line{ray.At(t), ray.Dir, ray.Time}
+		rec := New_hit_record()
+		if !s.Hit(&r, &rec) {
+			break
+		}
+		t += rec.T
+		rec.T = t
+
+		if rec.Front_face {
+			if enter == nil {
+				enter = &rec
+			}
+		} else if enter != nil {
+			res = append(res, Interval{*enter, rec})
+			enter = nil
+		}
+	}
+
+	return res
+}
+
+func (s *Sphere) Intervals(ray *Line) []Interval {
+	ro_so := ray.Origin
+	ro_so.Sub(s.Origin)
+	roots := solve_quadratic(ray.Dir.Dot(ray.Dir), 2*ray.Dir.Dot(ro_so), ro_so.Dot(ro_so)-s.Radius*s.Radius)
+	if len(roots) < 2 {
+		return nil
+	}
+
+	var in Interval
+	s.record(ray, roots[0], &in.Enter)
+	s.record(ray, roots[1], &in.Exit)
+	return []Interval{in}
+}
+
+type Operation int
+
+const (
+	Union Operation = iota
+	Intersection
+	// A with B cut out of it
+	Difference
+)
+
+// boolean combination of two closed shapes. csg nodes are closed shapes
+// themselves, so they can be nested
+type Csg struct {
+	Op Operation
+	A, B Shape
+}
+
+func (c *Csg) inside(in_a bool, in_b bool) bool {
+	switch c.Op {
+	case Intersection:
+		return in_a && in_b
+	case Difference:
+		return in_a && !in_b
+	}
+	return in_a || in_b
+}
+
+func (c *Csg) Intervals(ray *Line) []Interval {
+	type event struct {
+		rec HitRecord
+		from_b bool
+		enter bool
+	}
+
+	var events []event
+	for _, in := range Intervals(c.A, ray) {
+		events = append(events, event{in.Enter, false, true}, event{in.Exit, false, false})
+	}
+	for _, in := range Intervals(c.B, ray) {
+		events = append(events, event{in.Enter, true, true}, event{in.Exit, true, false})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].rec.T < events[j].rec.T })
+
+	// sweep along the ray and emit a boundary whenever the result changes
+	// from outside to inside or back
+	var res []Interval
+	in_a, in_b, inside := false, false, false
+	for _, e := range events {
+		if e.from_b {
+			in_b = e.enter
+		} else {
+			in_a = e.enter
+		}
+
+		now := c.inside(in_a, in_b)
+		if now == inside {
+			continue
+		}
+		inside = now
+
+		// the surfaces of B bound the result from the other side when B is
+		// cut out, so they face the other way
+		rec := e.rec
+		if c.Op == Difference && e.from_b {
+			rec.Geometric_normal.Scale(-1)
+			rec.Shading_normal.Scale(-1)
+			rec.Front_face = !rec.Front_face
+		}
+
+		if inside {
+			res = append(res, Interval{Enter: rec})
+		} else {
+			res[len(res)-1].Exit = rec
+		}
+	}
+
+	return res
+}
+
+func (c *Csg) Hit(ray *Line, rec *HitRecord) bool {
+	if !c.Bounds().Intersects(ray) {
+		return false
+	}
+
+	for _, in := range c.Intervals(ray) {
+		for _, boundary := range [2]*HitRecord{&in.Enter, &in.Exit} {
+			if boundary.T > hit_epsilon && boundary.T < rec.T {
+				*rec = *boundary
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c *Csg) Bounds() Aabb {
+	a := c.A.Bounds()
+	switch c.Op {
+	case Union:
+		a.Union(c.B.Bounds())
+	case Intersection:
+		b := c.B.Bounds()
+		a.Min = vec3.Vec3{math.Max(a.Min.X, b.Min.X), math.Max(a.Min.Y, b.Min.Y), math.Max(a.Min.Z, b.Min.Z)}
+		a.Max = vec3.Vec3{math.Min(a.Max.X, b.Max.X), math.Min(a.Max.Y, b.Max.Y), math.Min(a.Max.Z, b.Max.Z)}
+	}
+	return a
+}
+
+// the surface of a csg node isn't known without tracing it, so csg nodes
+// can't be used as emitters for light sampling
+func (c *Csg) Area() float64 {
+	return 0
+}
+
+func (c *Csg) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	box := c.Bounds()
+	center := box.Min
+	center.Add(box.Max)
+	center.Scale(0.5)
+	return center, vec3.Vec3{0, 0, 0}
+}
@@ -0,0 +1,95 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"testing"
+)
+
+// spheres covering [-2, 2] and [1, 5] along the x axis, which the test ray
+// from x = -10 reaches at t = 8 and t = 11
+func test_spheres() (*Sphere, *Sphere) {
+	return &Sphere{Origin: vec3.Vec3{0, 0, 0}, Radius: 2}, &Sphere{Origin: vec3.Vec3{3, 0, 0}, Radius: 2}
+}
+
+var csg_ray = Line{vec3.Vec3{-10, 0, 0}, vec3.Vec3{1, 0, 0}, 0}
+
+// checks the intervals against pairs of enter and exit distances and that
+// every boundary faces out of the result
+func check_intervals(t *testing.T, name string, res []Interval, want [][2]float64) {
+	if len(res) != len(want) {
+		t.Errorf("%s: %d intervals, want %d", name, len(res), len(want))
+		return
+	}
+	for i, in := range res {
+		if math.Abs(in.Enter.T-want[i][0]) > 1e-9 || math.Abs(in.Exit.T-want[i][1]) > 1e-9 {
+			t.Errorf("%s: interval %d is [%v, %v], want %v", name, i, in.Enter.T, in.Exit.T, want[i])
+		}
+		if in.Enter.Geometric_normal.X >= 0 || !in.Enter.Front_face {
+			t.Errorf("%s: interval %d is entered through %v", name, i, in.Enter.Geometric_normal)
+		}
+		if in.Exit.Geometric_normal.X <= 0 || in.Exit.Front_face {
+			t.Errorf("%s: interval %d is left through %v", name, i, in.Exit.Geometric_normal)
+		}
+	}
+}
+
+func Test_csg_intervals(t *testing.T) {
+	a, b := test_spheres()
+	check_intervals(t, "union", (&Csg{Op: Union, A: a, B: b}).Intervals(&csg_ray), [][2]float64{{8, 15}})
+	check_intervals(t, "intersection", (&Csg{Op: Intersection, A: a, B: b}).Intervals(&csg_ray), [][2]float64{{11, 12}})
+	// the surface of b bounds the result where it is cut out
+	check_intervals(t, "a - b", (&Csg{Op: Difference, A: a, B: b}).Intervals(&csg_ray), [][2]float64{{8, 11}})
+	check_intervals(t, "b - a", (&Csg{Op: Difference, A: b, B: a}).Intervals(&csg_ray), [][2]float64{{12, 15}})
+
+	// a hole through the middle splits a into two
+	hole := &Sphere{Origin: vec3.Vec3{0, 0, 0}, Radius: 1}
+	check_intervals(t, "a - hole", (&Csg{Op: Difference, A: a, B: hole}).Intervals(&csg_ray), [][2]float64{{8, 9}, {11, 12}})
+
+	// no overlap
+	far := &Sphere{Origin: vec3.Vec3{10, 0, 0}, Radius: 1}
+	check_intervals(t, "disjoint union", (&Csg{Op: Union, A: a, B: far}).Intervals(&csg_ray), [][2]float64{{8, 12}, {19, 21}})
+	check_intervals(t, "disjoint intersection", (&Csg{Op: Intersection, A: a, B: far}).Intervals(&csg_ray), nil)
+}
+
+func Test_csg_nested(t *testing.T) {
+	a, b := test_spheres()
+	hole := &Sphere{Origin: vec3.Vec3{1.5, 0, 0}, Radius: 0.25}
+	lens := &Csg{Op: Difference, A: &Csg{Op: Intersection, A: a, B: b}, B: hole}
+	check_intervals(t, "lens - hole", lens.Intervals(&csg_ray), [][2]float64{{11, 11.25}, {11.75, 12}})
+}
+
+func Test_intervals_by_walking(t *testing.T) {
+	// transformed shapes aren't solids, their surfaces are walked instead
+	a, _ := test_spheres()
+	moved := New_transformed(a, &Motion{0, 0, []Transform{Translation(3, 0, 0)}})
+	check_intervals(t, "walk", Intervals(moved, &csg_ray), [][2]float64{{11, 15}})
+
+	// intervals behind the origin of the ray are found too
+	behind := Line{vec3.Vec3{20, 0, 0}, vec3.Vec3{1, 0, 0}, 0}
+	check_intervals(t, "behind", Intervals(moved, &behind), [][2]float64{{-19, -15}})
+}
+
+func Test_csg_hit(t *testing.T) {
+	a, b := test_spheres()
+	diff := &Csg{Op: Difference, A: a, B: b}
+
+	rec := New_hit_record()
+	if !diff.Hit(&csg_ray, &rec) || math.Abs(rec.T-8) > 1e-9 {
+		t.Errorf("hit at %v, want 8", rec.T)
+	}
+
+	// from inside the result the ray leaves through the cut
+	inside := Line{vec3.Vec3{0, 0, 0}, vec3.Vec3{1, 0, 0}, 0}
+	rec = New_hit_record()
+	if !diff.Hit(&inside, &rec) || math.Abs(rec.T-1) > 1e-9 || rec.Front_face {
+		t.Errorf("left at %v, front face %v, want the back of the cut at 1", rec.T, rec.Front_face)
+	}
+
+	// inside b only, which isn't part of the result
+	in_b := Line{vec3.Vec3{4, 0, 0}, vec3.Vec3{1, 0, 0}, 0}
+	rec = New_hit_record()
+	if diff.Hit(&in_b, &rec) {
+		t.Errorf("hit at %v from inside the cut out part", rec.T)
+	}
+}
@@ -0,0 +1,118 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// two rays offset by one pixel to the right (x) and one pixel down (y)
+// that travel alongside the actual ray. where they hit a surface tells how
+// large a pixel is on it, which is what texture filtering needs
+type Ray_differential struct {
+	Valid bool
+	X_origin, X_dir vec3.Vec3
+	Y_origin, Y_dir vec3.Vec3
+}
+
+// intersects the offset ray with the tangent plane at the hit
+func offset_hit(rec *HitRecord, origin vec3.Vec3, dir vec3.Vec3) (vec3.Vec3, bool) {
+	n := rec.Geometric_normal
+	denom := n.Dot(dir)
+	if denom == 0 {
+		return origin, false
+	}
+
+	to_hit := rec.Position
+	to_hit.Sub(origin)
+	p := dir
+	p.Scale(to_hit.Dot(n) / denom)
+	p.Add(origin)
+	return p, true
+}
+
+// solves dpdu*du + dpdv*dv = dp for du and dv in the least squares sense
+func uv_change(rec *HitRecord, dp vec3.Vec3) (float64, float64) {
+	a, b, c := rec.Dpdu.Dot(rec.Dpdu), rec.Dpdu.Dot(rec.Dpdv), rec.Dpdv.Dot(rec.Dpdv)
+	det := a*c - b*b
+	if det == 0 {
+		return 0, 0
+	}
+
+	pu, pv := rec.Dpdu.Dot(dp), rec.Dpdv.Dot(dp)
+	return (c*pu - b*pv) / det, (a*pv - b*pu) / det
+}
+
+// fills in the uv derivatives of rec. without valid differentials they
+// stay 0, which means textures are point sampled
+func (d *Ray_differential) Footprint(rec *HitRecord) {
+	rec.Dudx, rec.Dvdx, rec.Dudy, rec.Dvdy = 0, 0, 0, 0
+	if !d.Valid {
+		return
+	}
+
+	px, ok_x := offset_hit(rec, d.X_origin, d.X_dir)
+	py, ok_y := offset_hit(rec, d.Y_origin, d.Y_dir)
+	if !ok_x || !ok_y {
+		return
+	}
+
+	px.Sub(rec.Position)
+	py.Sub(rec.Position)
+	rec.Dudx, rec.Dvdx = uv_change(rec, px)
+	rec.Dudy, rec.Dvdy = uv_change(rec, py)
+}
+
+// mirrors d about the normal n
+func Reflect(d vec3.Vec3, n vec3.Vec3) vec3.Vec3 {
+	n.Scale(2 * d.Dot(n))
+	d.Sub(n)
+	return d
+}
+
+// refracts the unit direction d through a surface with the unit normal n
+// on the side d comes from. eta is the index of refraction d comes from
+// over the one it enters. false for total internal reflection
+func Refract(d vec3.Vec3, n vec3.Vec3, eta float64) (vec3.Vec3, bool) {
+	cos_i := -d.Dot(n)
+	sin2_t := eta * eta * (1 - cos_i*cos_i)
+	if sin2_t > 1 {
+		return d, false
+	}
+	cos_t := math.Sqrt(1 - sin2_t)
+	d.Scale(eta)
+	n.Scale(eta*cos_i - cos_t)
+	d.Add(n)
+	return d, true
+}
+
+// fraction of unpolarized light a smooth dielectric reflects, cos_i is the
+// cosine of the incident angle and eta as in Refract
+func Fresnel(cos_i float64, eta float64) float64 {
+	sin2_t := eta * eta * (1 - cos_i*cos_i)
+	if sin2_t > 1 {
+		return 1
+	}
+	cos_t := math.Sqrt(1 - sin2_t)
+	rs := (eta*cos_i - cos_t) / (eta*cos_i + cos_t)
+	rp := (cos_i - eta*cos_t) / (cos_i + eta*cos_t)
+	return (rs*rs + rp*rp) / 2
+}
+
+// follows a mirror reflection about the normal n at the hit. the offset
+// rays start where they hit the tangent plane, the curvature of the
+// surface is ignored
+func (d *Ray_differential) Reflect(rec *HitRecord, n vec3.Vec3) {
+	if !d.Valid {
+		return
+	}
+
+	px, ok_x := offset_hit(rec, d.X_origin, d.X_dir)
+	py, ok_y := offset_hit(rec, d.Y_origin, d.Y_dir)
+	if !ok_x || !ok_y {
+		d.Valid = false
+		return
+	}
+
+	d.X_origin, d.X_dir = px, Reflect(d.X_dir, n)
+	d.Y_origin, d.Y_dir = py, Reflect(d.Y_dir, n)
+}
@@ -0,0 +1,155 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// everything the renderer needs to know about a ray hit. new surface
+// attributes go here instead of into the return values of the intersection
+// routines
+type HitRecord struct {
+	// hit distance along the ray, infinite if nothing was hit
+	T float64
+	Position vec3.Vec3
+	// normal of the actual surface, used for offsetting rays
+	Geometric_normal vec3.Vec3
+	// interpolated normal, used for shading
+	Shading_normal vec3.Vec3
+	// surface parameterization. for triangles these are the texture
+	// coordinates if there are any, barycentric coordinates otherwise
+	U, V float64
+	// partial derivatives of the position with respect to U and V
+	Dpdu, Dpdv vec3.Vec3
+	// change of U and V from one pixel to the next, see Ray_differential.
+	// all 0 if unknown
+	Dudx, Dvdx, Dudy, Dvdy float64
+	// true if the ray hit the side the geometric normal points to
+	Front_face bool
+	Mterial *Material
+	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+	// index of the primitive within its object and of the object within the scene
+	Prim_id, Object_id int
+}
+
+func New_hit_record() HitRecord {
+	return HitRecord{T: math.Inf(1), Prim_id: -1, Object_id: -1}
+}
+
+// turns the normals towards the side the ray came from, which one sided
+// surfaces like quads are lit from as well. Front_face still tells which
+// side was hit
+func (rec *HitRecord) Face_forward() {
+	if !rec.Front_face {
+		rec.Geometric_normal.Scale(-1)
+		rec.Shading_normal.Scale(-1)
+	}
+}
+
+// returns origin + t*dir
+func (ray *Line) At(t float64) vec3.Vec3 {
+	p := ray.Dir
+	p.Scale(t)
+	p.Add(ray.Origin)
+	return p
+}
+
+// moves a hit record from object space into world space
+func (rec *HitRecord) Transform(t Transform) {
+	inv := t.Inverse()
+	rec.Position = t.Apply_point(rec.Position)
+	rec.Geometric_normal = inv.apply_transposed(rec.Geometric_normal)
+	rec.Shading_normal = inv.apply_transposed(rec.Shading_normal)
+	rec.Dpdu = t.Apply_vector(rec.Dpdu)
+	rec.Dpdv = t.Apply_vector(rec.Dpdv)
+}
+
+func (t *Triangle) Hit(ray *Line, rec *HitRecord) bool {
+	intersection, d, u, v := t.Intersection(ray)
+	if !intersection || d >= rec.T {
+		return false
+	}
+
+	rec.T = d
+	rec.Position = ray.At(d)
+	rec.Geometric_normal = t.Face_normal()
+	rec.Shading_normal = t.Normal(u, v)
+	rec.U, rec.V = u, v
+	rec.Dpdu = t.B
+	rec.Dpdu.Sub(t.A)
+	rec.Dpdv = t.C
+	rec.Dpdv.Sub(t.A)
+
+	if t.Uvs != nil {
+		uv := t.Uvs
+		w := 1 - u - v
+		rec.U = w*uv[0][0] + u*uv[1][0] + v*uv[2][0]
+		rec.V = w*uv[0][1] + u*uv[1][1] + v*uv[2][1]
+
+		// express the edges in terms of the texture parameterization
+		du1, dv1 := uv[1][0]-uv[0][0], uv[1][1]-uv[0][1]
+		du2, dv2 := uv[2][0]-uv[0][0], uv[2][1]-uv[0][1]
+		det := du1*dv2 - dv1*du2
+		if det != 0 {
+			e1, e2 := rec.Dpdu, rec.Dpdv
+			a, b := e1, e2
+			a.Scale(dv2 / det)
+			b.Scale(-dv1 / det)
+			a.Add(b)
+			rec.Dpdu = a
+			a, b = e1, e2
+			a.Scale(-du2 / det)
+			b.Scale(du1 / det)
+			a.Add(b)
+			rec.Dpdv = a
+		}
+	}
+	rec.Front_face = ray.Dir.Dot(rec.Geometric_normal) < 0
+	rec.Mterial = &t.Mterial
+	rec.Pdf = t.Pdf
+	rec.Prim_id = 0
+	return true
+}
+
+func (s *Sphere) Hit(ray *Line, rec *HitRecord) bool {
+	intersection, d := s.Intersection(ray)
+	if !intersection || d >= rec.T {
+		return false
+	}
+
+	s.record(ray, d, rec)
+	return true
+}
+
+// fills rec for the point at distance d along the ray, which has to lie on the sphere
+func (s *Sphere) record(ray *Line, d float64, rec *HitRecord) {
+	rec.T = d
+	rec.Position = ray.At(d)
+
+	normal := rec.Position
+	normal.Sub(s.Origin)
+	// normalize by dividing by radius instead of using Normalize()
+	normal.Scale(1.0 / s.Radius)
+	rec.Geometric_normal = normal
+	rec.Shading_normal = normal
+
+	// spherical coordinates, u goes around the y axis and v from pole to pole
+	phi := math.Atan2(normal.Z, normal.X)
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	theta := math.Acos(math.Max(-1, math.Min(1, normal.Y)))
+	rec.U = phi / (2 * math.Pi)
+	rec.V = theta / math.Pi
+	rec.Dpdu = vec3.Vec3{-2 * math.Pi * s.Radius * normal.Z, 0, 2 * math.Pi * s.Radius * normal.X}
+	rec.Dpdv = vec3.Vec3{
+		math.Pi * s.Radius * math.Cos(theta) * math.Cos(phi),
+		-math.Pi * s.Radius * math.Sin(theta),
+		math.Pi * s.Radius * math.Cos(theta) * math.Sin(phi),
+	}
+
+	rec.Front_face = ray.Dir.Dot(normal) < 0
+	rec.Mterial = &s.Mterial
+	rec.Pdf = s.Pdf
+	rec.Prim_id = 0
+}
@@ -0,0 +1,161 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/texture"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// looks up t at the hit, filtered over its footprint
+func lookup(t texture.Texture, rec *HitRecord) vec3.Vec3 {
+	return texture.Lookup(t, rec.U, rec.V, rec.Position, rec.Dudx, rec.Dvdx, rec.Dudy, rec.Dvdy)
+}
+
+// diffuse color at the hit
+func (m *Material) Diffuse_at(rec *HitRecord) vec3.Vec3 {
+	if m.Diffuse_texture != nil {
+		return lookup(m.Diffuse_texture, rec)
+	}
+	return m.Diffuse_color
+}
+
+// emission strength at the hit. textures use the average of their
+// channels, the color of the light comes from Emission_color_at
+func (m *Material) Emission_at(rec *HitRecord) float64 {
+	if m.Emission_texture != nil && m.Emission > 0 {
+		c := lookup(m.Emission_texture, rec)
+		return m.Emission * (c.X + c.Y + c.Z) / 3
+	}
+	return m.Emission
+}
+
+// emission strength at the hit in the unit direction out, which leaves
+// the surface. the profile of the material shapes it like a real fixture
+func (m *Material) Emission_toward(rec *HitRecord, out vec3.Vec3) float64 {
+	emission := m.Emission_at(rec)
+	if m.Profile == nil || emission == 0 {
+		return emission
+	}
+
+	nadir := rec.Geometric_normal
+	if nadir.Dot(out) < 0 {
+		nadir.Scale(-1)
+	}
+	a, b := Basis(nadir)
+	theta := math.Acos(math.Max(-1, math.Min(1, out.Dot(nadir))))
+	return emission * m.Profile.At(theta, math.Atan2(out.Dot(b), out.Dot(a)))
+}
+
+// color of the emitted light at the hit
+func (m *Material) Emission_color_at(rec *HitRecord) vec3.Vec3 {
+	if m.Emission_color.Dot(m.Emission_color) > 0 {
+		return m.Emission_color
+	}
+	return m.Diffuse_at(rec)
+}
+
+// radiance emitted at the hit in the unit direction out
+func (m *Material) Emitted(rec *HitRecord, out vec3.Vec3) vec3.Vec3 {
+	res := m.Emission_color_at(rec)
+	res.Scale(m.Emission_toward(rec, out))
+	return res
+}
+
+// roughness at the hit
+func (m *Material) Roughness_at(rec *HitRecord) float64 {
+	if m.Roughness_texture != nil {
+		return lookup(m.Roughness_texture, rec).X
+	}
+	return m.Roughness
+}
+
+// opacity at the hit, surfaces without an alpha mask are opaque
+func (m *Material) Alpha_at(rec *HitRecord) float64 {
+	if m.Alpha != nil {
+		return lookup(m.Alpha, rec).X
+	}
+	return 1
+}
+
+// uv step used to differentiate height maps
+const bump_delta = 1.0 / 1024
+
+// bends the shading normal of the hit by the normal and bump maps of the
+// material. the geometric normal is left untouched, it still describes
+// the actual surface rays have to leave from
+func (m *Material) Perturb_normal(rec *HitRecord) {
+	if m.Normal_map == nil && m.Bump_map == nil {
+		return
+	}
+
+	n := rec.Shading_normal
+	res := n
+
+	// tangent frame from the uv parameterization, made orthonormal to the
+	// shading normal. b follows the direction of increasing v
+	t := n
+	t.Scale(-n.Dot(rec.Dpdu))
+	t.Add(rec.Dpdu)
+	if t.Dot(t) < 1e-12 {
+		return
+	}
+	t.Normalize()
+	b := n
+	b.Cross(t)
+	if b.Dot(rec.Dpdv) < 0 {
+		b.Scale(-1)
+	}
+
+	if m.Normal_map != nil {
+		c := lookup(m.Normal_map, rec)
+		res = t
+		res.Scale(2*c.X - 1)
+		by := b
+		by.Scale(2*c.Y - 1)
+		nz := n
+		nz.Scale(2*c.Z - 1)
+		res.Add(by)
+		res.Add(nz)
+	}
+
+	if m.Bump_map != nil {
+		// displacing the surface along the normal by the height tilts the
+		// tangents by the slopes of the height
+		// solid textures are stepped along the surface as well
+		pu := rec.Dpdu
+		pu.Scale(bump_delta)
+		pu.Add(rec.Position)
+		pv := rec.Dpdv
+		pv.Scale(bump_delta)
+		pv.Add(rec.Position)
+		h := m.Bump_map.At(rec.U, rec.V, rec.Position).X
+		dhdu := (m.Bump_map.At(rec.U+bump_delta, rec.V, pu).X - h) / bump_delta
+		dhdv := (m.Bump_map.At(rec.U, rec.V+bump_delta, pv).X - h) / bump_delta
+
+		base := res
+		base.Normalize()
+		dpdu := base
+		dpdu.Scale(m.Bump_scale * dhdu)
+		dpdu.Add(rec.Dpdu)
+		dpdv := base
+		dpdv.Scale(m.Bump_scale * dhdv)
+		dpdv.Add(rec.Dpdv)
+
+		res = dpdu
+		res.Cross(dpdv)
+		if res.Dot(base) < 0 {
+			res.Scale(-1)
+		}
+	}
+
+	if res.Dot(res) < 1e-12 {
+		return
+	}
+	res.Normalize()
+
+	// a normal facing away from the surface would let light leak through it
+	if res.Dot(rec.Geometric_normal)*n.Dot(rec.Geometric_normal) <= 0 {
+		return
+	}
+	rec.Shading_normal = res
+}
@@ -0,0 +1,125 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// world transforms of a moving object, sampled uniformly over the shutter
+// interval. in between samples the matrices are interpolated linearly
+type Motion struct {
+	Open, Close float64
+	Xforms []Transform
+}
+
+// returns the world transform at the given time
+func (m *Motion) At(time float64) Transform {
+	last := len(m.Xforms) - 1
+	if last == 0 || time <= m.Open {
+		return m.Xforms[0]
+	}
+
+	if time >= m.Close {
+		return m.Xforms[last]
+	}
+
+	f := (time - m.Open) / (m.Close - m.Open) * float64(last)
+	i := int(f)
+	if i >= last {
+		return m.Xforms[last]
+	}
+	s := f - float64(i)
+
+	var res Transform
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			res.M[r][c] = (1-s)*m.Xforms[i].M[r][c] + s*m.Xforms[i+1].M[r][c]
+		}
+	}
+
+	return res
+}
+
+// axis aligned bounding box
+type Aabb struct {
+	Min, Max vec3.Vec3
+}
+
+func Empty_aabb() Aabb {
+	return Aabb{vec3.Vec3{math.Inf(1), math.Inf(1), math.Inf(1)}, vec3.Vec3{math.Inf(-1), math.Inf(-1), math.Inf(-1)}}
+}
+
+// grows the box so that it contains p
+func (b *Aabb) Extend(p vec3.Vec3) {
+	b.Min = vec3.Vec3{math.Min(b.Min.X, p.X), math.Min(b.Min.Y, p.Y), math.Min(b.Min.Z, p.Z)}
+	b.Max = vec3.Vec3{math.Max(b.Max.X, p.X), math.Max(b.Max.Y, p.Y), math.Max(b.Max.Z, p.Z)}
+}
+
+// grows the box so that it contains c
+func (b *Aabb) Union(c Aabb) {
+	b.Extend(c.Min)
+	b.Extend(c.Max)
+}
+
+// slab test, returns true if the ray hits the box in front of its origin
+func (b Aabb) Intersects(ray *Line) bool {
+	_, _, hit := b.Range(ray)
+	return hit
+}
+
+// returns the stretch [t_min, t_max] of the ray in front of its origin that
+// lies inside the box and whether there is one at all
+func (b Aabb) Range(ray *Line) (float64, float64, bool) {
+	t_min := 0.0
+	t_max := math.Inf(1)
+
+	origin := [3]float64{ray.Origin.X, ray.Origin.Y, ray.Origin.Z}
+	dir := [3]float64{ray.Dir.X, ray.Dir.Y, ray.Dir.Z}
+	lo := [3]float64{b.Min.X, b.Min.Y, b.Min.Z}
+	hi := [3]float64{b.Max.X, b.Max.Y, b.Max.Z}
+
+	for i := 0; i < 3; i++ {
+		inv_d := 1.0 / dir[i]
+		t0 := (lo[i] - origin[i]) * inv_d
+		t1 := (hi[i] - origin[i]) * inv_d
+		if inv_d < 0 {
+			t0, t1 = t1, t0
+		}
+
+		// NaNs (ray parallel to and inside a slab) leave the interval untouched
+		if t0 > t_min {
+			t_min = t0
+		}
+		if t1 < t_max {
+			t_max = t1
+		}
+		if t_min > t_max {
+			return 0, 0, false
+		}
+	}
+
+	return t_min, t_max, true
+}
+
+// returns the ray transformed by t. the direction is not normalized, so hit
+// distances along the transformed ray equal those along the original ray
+func (t Transform) Apply_line(ray *Line) Line {
+	return Line{t.Apply_point(ray.Origin), t.Apply_vector(ray.Dir), ray.Time}
+}
+
+// transforms a surface normal, i.e. applies the inverse transpose
+func (t Transform) Apply_normal(n vec3.Vec3) vec3.Vec3 {
+	return t.Inverse().apply_transposed(n)
+}
+
+// applies the transpose of the linear part and normalizes the result.
+// called on the inverse this transforms normals
+func (t Transform) apply_transposed(n vec3.Vec3) vec3.Vec3 {
+	res := vec3.Vec3{
+		t.M[0][0]*n.X + t.M[1][0]*n.Y + t.M[2][0]*n.Z,
+		t.M[0][1]*n.X + t.M[1][1]*n.Y + t.M[2][1]*n.Z,
+		t.M[0][2]*n.X + t.M[1][2]*n.Y + t.M[2][2]*n.Z,
+	}
+	res.Normalize()
+	return res
+}
@@ -0,0 +1,69 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"testing"
+)
+
+// moves along x from 0 at time 0 to 30 at time 3 and then up to y = 10
+// at time 4
+func test_motion() *Motion {
+	return &Motion{0, 4, []Transform{
+		Translation(0, 0, 0),
+		Translation(10, 0, 0),
+		Translation(20, 0, 0),
+		Translation(30, 0, 0),
+		Translation(30, 10, 0),
+	}}
+}
+
+func Test_motion_at(t *testing.T) {
+	m := test_motion()
+	origin := vec3.Vec3{0, 0, 0}
+	for _, c := range []struct {
+		time float64
+		want vec3.Vec3
+	}{
+		// clamped outside of the shutter interval
+		{-1, vec3.Vec3{0, 0, 0}},
+		{5, vec3.Vec3{30, 10, 0}},
+		// the samples themselves
+		{0, vec3.Vec3{0, 0, 0}},
+		{2, vec3.Vec3{20, 0, 0}},
+		{4, vec3.Vec3{30, 10, 0}},
+		// linear in between
+		{0.25, vec3.Vec3{2.5, 0, 0}},
+		{3.5, vec3.Vec3{30, 5, 0}},
+	} {
+		if p := m.At(c.time).Apply_point(origin); !near_vec(p, c.want, 1e-12) {
+			t.Errorf("at %v the origin is at %v, want %v", c.time, p, c.want)
+		}
+	}
+}
+
+func Test_motion_at_single_sample(t *testing.T) {
+	m := &Motion{0, 1, []Transform{Translation(1, 2, 3)}}
+	if p := m.At(0.5).Apply_point(vec3.Vec3{0, 0, 0}); !near_vec(p, vec3.Vec3{1, 2, 3}, 0) {
+		t.Errorf("static motion moved to %v", p)
+	}
+}
+
+func Test_moving_bounds(t *testing.T) {
+	moving := New_transformed(&Sphere{Origin: vec3.Vec3{0, 0, 0}, Radius: 1}, test_motion())
+	box := moving.Bounds()
+	if !near_vec(box.Min, vec3.Vec3{-1, -1, -1}, 1e-12) || !near_vec(box.Max, vec3.Vec3{31, 11, 1}, 1e-12) {
+		t.Fatalf("bounds %v, want the whole motion", box)
+	}
+
+	// a bvh finds the sphere wherever it is while the shutter is open
+	bvh := New_bvh([]Shape{&Sphere{Origin: vec3.Vec3{-50, 0, 0}, Radius: 1}, moving})
+	for _, time := range []float64{0, 1.5, 3, 3.5, 4} {
+		center := test_motion().At(time).Apply_point(vec3.Vec3{0, 0, 0})
+		ray := Line{vec3.Vec3{center.X, center.Y, -10}, vec3.Vec3{0, 0, 1}, time}
+		rec := New_hit_record()
+		if id := bvh.Hit(&ray, &rec); id != 1 || math.Abs(rec.T-9) > 1e-9 {
+			t.Errorf("at %v hit shape %d at %v, want shape 1 at 9", time, id, rec.T)
+		}
+	}
+}
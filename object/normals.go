@@ -0,0 +1,58 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// angle between the edges from corner p to q and from corner p to r
+func corner_angle(p vec3.Vec3, q vec3.Vec3, r vec3.Vec3) float64 {
+	q.Sub(p)
+	r.Sub(p)
+	cos := q.Dot(r) / (q.Euclidean_norm() * r.Euclidean_norm())
+	return math.Acos(math.Max(-1, math.Min(1, cos)))
+}
+
+// generates angle-weighted vertex normals for the whole mesh. triangles
+// sharing a vertex position are smoothed together unless their face normals
+// differ by more than crease (in radians), which keeps hard edges sharp
+func (o *Object) Smooth_normals(crease float64) {
+	type corner struct {
+		normal vec3.Vec3
+		angle float64
+	}
+
+	face_normals := make([]vec3.Vec3, len(o.Mesh))
+	corners := map[vec3.Vec3][]corner{}
+	for i := 0; i < len(o.Mesh); i++ {
+		t := &o.Mesh[i]
+		face_normals[i] = t.Face_normal()
+		corners[t.A] = append(corners[t.A], corner{face_normals[i], corner_angle(t.A, t.B, t.C)})
+		corners[t.B] = append(corners[t.B], corner{face_normals[i], corner_angle(t.B, t.C, t.A)})
+		corners[t.C] = append(corners[t.C], corner{face_normals[i], corner_angle(t.C, t.A, t.B)})
+	}
+
+	cos_crease := math.Cos(crease)
+	vertex_normal := func(p vec3.Vec3, face_normal vec3.Vec3) vec3.Vec3 {
+		normal := vec3.Vec3{0, 0, 0}
+		for _, c := range corners[p] {
+			if c.normal.Dot(face_normal) < cos_crease {
+				continue
+			}
+			n := c.normal
+			n.Scale(c.angle)
+			normal.Add(n)
+		}
+		normal.Normalize()
+		return normal
+	}
+
+	for i := 0; i < len(o.Mesh); i++ {
+		t := &o.Mesh[i]
+		t.Normals = &[3]vec3.Vec3{
+			vertex_normal(t.A, face_normals[i]),
+			vertex_normal(t.B, face_normals[i]),
+			vertex_normal(t.C, face_normals[i]),
+		}
+	}
+}
@@ -1,18 +1,29 @@
 package object
 
 import (
+	"github.com/supermuesli/pathtracer/ies"
+	"github.com/supermuesli/pathtracer/medium"
+	"github.com/supermuesli/pathtracer/spectrum"
+	"github.com/supermuesli/pathtracer/texture"
 	"github.com/supermuesli/pathtracer/vec3"
 	"math"
 )
 
 type Line struct {
 	Origin, Dir vec3.Vec3
+	// point in time within the shutter interval the ray was shot at
+	Time float64
 }
 
 type Triangle struct {
 	A, B, C vec3.Vec3
 	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3 
 	Mterial Material
+	// optional per-vertex normals at A, B and C. if nil the triangle is flat shaded
+	Normals *[3]vec3.Vec3
+	// optional texture coordinates at A, B and C. if nil the barycentric
+	// coordinates are used instead
+	Uvs *[3][2]float64
 }
 
 type Sphere struct {
@@ -24,11 +35,52 @@ type Sphere struct {
 
 type Object struct {
 	Mesh []Triangle
+	// bvh over the triangles of the mesh, see Update_bounds
+	bvh *Bvh
 }
 
 type Material struct {
 	Diffuse_color vec3.Vec3
+	// strength of the emitted light
 	Emission float64
+	// color of the emitted light, e.g. light.Blackbody(2700). the diffuse
+	// color is used if it is zero
+	Emission_color vec3.Vec3
+	// blurs mirror reflections, 0 keeps the mirrored direction and 1
+	// scatters like a diffuse surface. diffuse surfaces ignore it
+	Roughness float64
+	// optional textures. Diffuse_texture and Roughness_texture replace the
+	// constants above, Emission_texture scales Emission
+	Diffuse_texture texture.Texture
+	Roughness_texture texture.Texture
+	Emission_texture texture.Texture
+	// optional tangent space normal map, see texture.Load_data
+	Normal_map texture.Texture
+	// optional height map. Bump_scale is the height of a value of 1 in
+	// world units
+	Bump_map texture.Texture
+	Bump_scale float64
+	// optional opacity, 0 cuts the surface out. fractional values let rays
+	// pass through randomly
+	Alpha texture.Texture
+	// optional intensity distribution of a real fixture for emissive
+	// surfaces, its nadir points along the surface normal on either side.
+	// Emission is the radiance at the peak of the profile
+	Profile *ies.Profile
+	// optional medium filling the inside of a closed surface. the surface
+	// then only bounds the medium, rays pass through it without scattering.
+	// media must not overlap
+	Interior medium.Medium
+	// optional medium for subsurface scattering, e.g. medium.New_subsurface.
+	// light enters the closed surface, scatters around inside and leaves it
+	// somewhere else, which makes skin, wax or marble translucent. the
+	// diffuse color and the Pdf of the primitive don't apply then
+	Subsurface medium.Medium
+	// optional index of refraction, e.g. spectrum.Bk7. the surface is then
+	// smooth glass that reflects and refracts by the fresnel equations, and
+	// the diffuse color and the Pdf of the primitive don't apply. indices
+	// that vary with the wavelength split white light in spectral mode
+	Ior spectrum.Ior
 }
 
 // move object in 3d space
@@ -47,6 +99,13 @@ func (o *Object) Rotate_x(x float64) {
 		o.Mesh[i].A.Rotate_x(x)
 		o.Mesh[i].C.Rotate_x(x)
 		o.Mesh[i].B.Rotate_x(x)
+		if o.Mesh[i].Normals != nil {
+			n := *o.Mesh[i].Normals
+			n[0].Rotate_x(x)
+			n[1].Rotate_x(x)
+			n[2].Rotate_x(x)
+			o.Mesh[i].Normals = &n
+		}
 	}
 }
 
@@ -56,6 +115,13 @@ func (o *Object) Rotate_y(x float64) {
 		o.Mesh[i].A.Rotate_y(x)
 		o.Mesh[i].C.Rotate_y(x)
 		o.Mesh[i].B.Rotate_y(x)
+		if o.Mesh[i].Normals != nil {
+			n := *o.Mesh[i].Normals
+			n[0].Rotate_y(x)
+			n[1].Rotate_y(x)
+			n[2].Rotate_y(x)
+			o.Mesh[i].Normals = &n
+		}
 	}
 }
 
@@ -65,48 +131,35 @@ func (o *Object) Rotate_z(x float64) {
 		o.Mesh[i].A.Rotate_z(x)
 		o.Mesh[i].C.Rotate_z(x)
 		o.Mesh[i].B.Rotate_z(x)
+		if o.Mesh[i].Normals != nil {
+			n := *o.Mesh[i].Normals
+			n[0].Rotate_z(x)
+			n[1].Rotate_z(x)
+			n[2].Rotate_z(x)
+			o.Mesh[i].Normals = &n
+		}
 	}
 }
 
-func min (a float64, b float64) float64 {
-	if a < b {
-		return a
-	}
-
-	return b
-}
-
 func (s Sphere) Intersection(ray *Line) (bool, float64) {
 	ro_so := ray.Origin
 	ro_so.Sub(s.Origin)
-	rd_so_dot := ray.Dir.Dot(ro_so)
-	t := math.Pow(rd_so_dot, 2) - math.Pow(ro_so.Euclidean_norm(), 2) + math.Pow(s.Radius, 2)
-	d1 := -rd_so_dot + math.Sqrt(t)
-	d2 := -rd_so_dot - math.Sqrt(t)
-
-	if d1 < 0 && d2 < 0 {
-		if math.IsNaN(d1) && math.IsNaN(d2) {
-			return false, math.Inf(1)
-		}
-	}
-
-	if math.IsNaN(d1) {
-		d1 = math.Inf(1)
-	}
 
-	if math.IsNaN(d2) {
-		d2 = math.Inf(1)
-	}
-
-	_min := min(d1, d2)
-	if _min > 0 {
-		return true, _min
+	// the direction isn't assumed to be normalized, rays in object space
+	// of a scaled sphere aren't
+	roots := solve_quadratic(ray.Dir.Dot(ray.Dir), 2*ray.Dir.Dot(ro_so), ro_so.Dot(ro_so) - s.Radius*s.Radius)
+	for _, d := range roots {
+		if d > hit_epsilon {
+			return true, d
+		}
 	}
 
 	return false, math.Inf(1)
 }
 
-func (t Triangle) Intersection(ray *Line) (bool, float64) {
+// returns whether the ray hits the triangle, the hit distance and the
+// barycentric coordinates u, v of the hit (weights of B and C)
+func (t Triangle) Intersection(ray *Line) (bool, float64, float64, float64) {
 	const epsilon = 0.001 // minimum offset distance (otherwise rays will always intersect the hit_positions they're on)
 
 	ta := t.A
@@ -124,7 +177,7 @@ func (t Triangle) Intersection(ray *Line) (bool, float64) {
 	a := edge1.Dot(h)
 	
 	if a > -epsilon && a < epsilon {
-		return false, 0
+		return false, 0, 0, 0
 	}
 
 	f := 1.0/a
@@ -134,7 +187,7 @@ func (t Triangle) Intersection(ray *Line) (bool, float64) {
 	u := f * (s.Dot(h))
 	
 	if u < 0.0 || u > 1.0 {
-		return false, 0
+		return false, 0, 0, 0
 	}
 
 	s.Cross(edge1)
@@ -143,7 +196,7 @@ func (t Triangle) Intersection(ray *Line) (bool, float64) {
 	v := f * raydir.Dot(q)
 
 	if v < 0.0 || u + v > 1.0 {
-		return false, 0
+		return false, 0, 0, 0
 	}
 	
 	// At this stage we can compute d to find out where the intersection point is on the line (hit_vector = ray.origin + d*ray.direction).
@@ -151,9 +204,39 @@ func (t Triangle) Intersection(ray *Line) (bool, float64) {
 
 	// ray intersection
 	if d > epsilon { 
-		return true, d
+		return true, d, u, v
 	}
 
 	// This means that there is a line intersection but not a ray intersection.
-	return false, 0
+	return false, 0, 0, 0
+}
+
+
+// geometric normal, oriented by the winding order A, B, C
+func (t *Triangle) Face_normal() vec3.Vec3 {
+	normal := t.B
+	c := t.C
+	normal.Sub(t.A)
+	c.Sub(t.A)
+	normal.Cross(c)
+	normal.Normalize()
+	return normal
+}
+
+// shading normal at barycentric coordinates u, v
+func (t *Triangle) Normal(u float64, v float64) vec3.Vec3 {
+	if t.Normals == nil {
+		return t.Face_normal()
+	}
+
+	normal := t.Normals[0]
+	normal.Scale(1 - u - v)
+	nb := t.Normals[1]
+	nb.Scale(u)
+	nc := t.Normals[2]
+	nc.Scale(v)
+	normal.Add(nb)
+	normal.Add(nc)
+	normal.Normalize()
+	return normal
 }
@@ -0,0 +1,600 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// minimum hit distance of the analytic primitives (otherwise rays will
+// always intersect the surfaces they start on)
+const hit_epsilon = 0.001
+
+// infinite plane through Point
+type Plane struct {
+	Point, Normal vec3.Vec3
+	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+	Mterial Material
+}
+
+// parallelogram spanned by the edges U and V starting at Corner
+type Quad struct {
+	Corner, U, V vec3.Vec3
+	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+	Mterial Material
+}
+
+type Disk struct {
+	Center, Normal vec3.Vec3
+	Radius float64
+	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+	Mterial Material
+}
+
+// capped cylinder from Origin (center of the bottom cap) along the y axis.
+// use a scene node to orient it differently
+type Cylinder struct {
+	Origin vec3.Vec3
+	Radius, Height float64
+	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+	Mterial Material
+}
+
+// capped cone with its base centered at Origin and its apex Height above
+// along the y axis
+type Cone struct {
+	Origin vec3.Vec3
+	Radius, Height float64
+	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+	Mterial Material
+}
+
+// torus around the y axis through Origin. Major is the distance from the
+// center to the middle of the tube, Minor the radius of the tube
+type Torus struct {
+	Origin vec3.Vec3
+	Major, Minor float64
+	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+	Mterial Material
+}
+
+// returns two unit vectors that form an orthonormal basis together with n
+func Basis(n vec3.Vec3) (vec3.Vec3, vec3.Vec3) {
+	// Duff et al., building an orthonormal basis, revisited
+	sign := math.Copysign(1, n.Z)
+	a := -1 / (sign + n.Z)
+	b := n.X * n.Y * a
+	s := vec3.Vec3{1 + sign*n.X*n.X*a, sign * b, -sign * n.X}
+	t := vec3.Vec3{b, sign + n.Y*n.Y*a, -n.Y}
+	return s, t
+}
+
+// fills in the surface attributes shared by all analytic primitives
+func (rec *HitRecord) set(ray *Line, t float64, normal vec3.Vec3, u float64, v float64, dpdu vec3.Vec3, dpdv vec3.Vec3, mat *Material, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3) {
+	rec.T = t
+	rec.Position = ray.At(t)
+	rec.Geometric_normal = normal
+	rec.Shading_normal = normal
+	rec.U, rec.V = u, v
+	rec.Dpdu, rec.Dpdv = dpdu, dpdv
+	rec.Front_face = ray.Dir.Dot(normal) < 0
+	rec.Mterial = mat
+	rec.Pdf = pdf
+	rec.Prim_id = 0
+}
+
+func (p *Plane) Material() *Material {
+	return &p.Mterial
+}
+
+func (q *Quad) Material() *Material {
+	return &q.Mterial
+}
+
+func (d *Disk) Material() *Material {
+	return &d.Mterial
+}
+
+func (c *Cylinder) Material() *Material {
+	return &c.Mterial
+}
+
+func (c *Cone) Material() *Material {
+	return &c.Mterial
+}
+
+func (tor *Torus) Material() *Material {
+	return &tor.Mterial
+}
+
+// returns the distance at which the ray hits the plane through p with normal n
+func plane_distance(ray *Line, p vec3.Vec3, n vec3.Vec3) float64 {
+	denom := n.Dot(ray.Dir)
+	if math.Abs(denom) < 1e-12 {
+		return math.Inf(1)
+	}
+
+	p.Sub(ray.Origin)
+	return p.Dot(n) / denom
+}
+
+// returns the angle of (x, z) around the y axis in [0, 2pi)
+func azimuth(x float64, z float64) float64 {
+	phi := math.Atan2(z, x)
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	return phi
+}
+
+// a box that is flat along an axis is padded a little so that the slab
+// test stays robust
+func (b *Aabb) pad() {
+	const eps = 1e-6
+	b.Min.Sub(vec3.Vec3{eps, eps, eps})
+	b.Max.Add(vec3.Vec3{eps, eps, eps})
+}
+
+func (p *Plane) Hit(ray *Line, rec *HitRecord) bool {
+	n := p.Normal
+	n.Normalize()
+	t := plane_distance(ray, p.Point, n)
+	if t <= hit_epsilon || t >= rec.T {
+		return false
+	}
+
+	// uv are the world space coordinates of the hit within the plane
+	s, r := Basis(n)
+	d := ray.At(t)
+	d.Sub(p.Point)
+	rec.set(ray, t, n, d.Dot(s), d.Dot(r), s, r, &p.Mterial, p.Pdf)
+	return true
+}
+
+func (p *Plane) Bounds() Aabb {
+	return Aabb{vec3.Vec3{math.Inf(-1), math.Inf(-1), math.Inf(-1)}, vec3.Vec3{math.Inf(1), math.Inf(1), math.Inf(1)}}
+}
+
+func (p *Plane) Area() float64 {
+	return math.Inf(1)
+}
+
+// an infinite plane can't be sampled uniformly, so this always returns Point
+func (p *Plane) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	return p.Point, p.Normal
+}
+
+func (q *Quad) normal() (vec3.Vec3, float64) {
+	n := q.U
+	n.Cross(q.V)
+	area := n.Euclidean_norm()
+	n.Scale(1 / area)
+	return n, area
+}
+
+func (q *Quad) Hit(ray *Line, rec *HitRecord) bool {
+	n, area := q.normal()
+	t := plane_distance(ray, q.Corner, n)
+	if t <= hit_epsilon || t >= rec.T {
+		return false
+	}
+
+	// coordinates of the hit in the basis U, V
+	d := ray.At(t)
+	d.Sub(q.Corner)
+	w := n
+	w.Scale(1 / area)
+	dv := d
+	dv.Cross(q.V)
+	ud := q.U
+	ud.Cross(d)
+	alpha := w.Dot(dv)
+	beta := w.Dot(ud)
+	if alpha < 0 || alpha > 1 || beta < 0 || beta > 1 {
+		return false
+	}
+
+	rec.set(ray, t, n, alpha, beta, q.U, q.V, &q.Mterial, q.Pdf)
+	return true
+}
+
+func (q *Quad) Bounds() Aabb {
+	box := Empty_aabb()
+	for _, c := range [4][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		p := q.Corner
+		u := q.U
+		u.Scale(c[0])
+		v := q.V
+		v.Scale(c[1])
+		p.Add(u)
+		p.Add(v)
+		box.Extend(p)
+	}
+	box.pad()
+	return box
+}
+
+func (q *Quad) Area() float64 {
+	_, area := q.normal()
+	return area
+}
+
+func (q *Quad) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	p := q.Corner
+	u := q.U
+	u.Scale(u1)
+	v := q.V
+	v.Scale(u2)
+	p.Add(u)
+	p.Add(v)
+	n, _ := q.normal()
+	return p, n
+}
+
+func (d *Disk) Hit(ray *Line, rec *HitRecord) bool {
+	n := d.Normal
+	n.Normalize()
+	t := plane_distance(ray, d.Center, n)
+	if t <= hit_epsilon || t >= rec.T {
+		return false
+	}
+
+	p := ray.At(t)
+	p.Sub(d.Center)
+	dist := p.Euclidean_norm()
+	if dist > d.Radius {
+		return false
+	}
+
+	// polar coordinates, u goes around the center and v outwards
+	s, r := Basis(n)
+	phi := math.Atan2(p.Dot(r), p.Dot(s))
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	radial := s
+	radial.Scale(math.Cos(phi))
+	tangent := r
+	tangent.Scale(math.Sin(phi))
+	radial.Add(tangent)
+	tangent = n
+	tangent.Cross(radial)
+	tangent.Scale(2 * math.Pi * dist)
+	radial.Scale(d.Radius)
+
+	rec.set(ray, t, n, phi/(2*math.Pi), dist/d.Radius, tangent, radial, &d.Mterial, d.Pdf)
+	return true
+}
+
+func (d *Disk) Bounds() Aabb {
+	n := d.Normal
+	n.Normalize()
+	// extent of the disk along each axis is radius * sin(angle to the normal)
+	e := vec3.Vec3{
+		d.Radius * math.Sqrt(math.Max(0, 1-n.X*n.X)),
+		d.Radius * math.Sqrt(math.Max(0, 1-n.Y*n.Y)),
+		d.Radius * math.Sqrt(math.Max(0, 1-n.Z*n.Z)),
+	}
+	box := Aabb{d.Center, d.Center}
+	box.Min.Sub(e)
+	box.Max.Add(e)
+	box.pad()
+	return box
+}
+
+func (d *Disk) Area() float64 {
+	return math.Pi * d.Radius * d.Radius
+}
+
+func (d *Disk) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	n := d.Normal
+	n.Normalize()
+	s, r := Basis(n)
+	dist := d.Radius * math.Sqrt(u1)
+	phi := 2 * math.Pi * u2
+	s.Scale(dist * math.Cos(phi))
+	r.Scale(dist * math.Sin(phi))
+
+	p := d.Center
+	p.Add(s)
+	p.Add(r)
+	return p, n
+}
+
+// intersects the ray (o, dir relative to the primitive's origin) with the
+// horizontal disk of the given radius at height y. returns the distance
+// or infinity
+func cap_distance(o vec3.Vec3, dir vec3.Vec3, y float64, radius float64) float64 {
+	if dir.Y == 0 {
+		return math.Inf(1)
+	}
+
+	t := (y - o.Y) / dir.Y
+	x := o.X + t*dir.X
+	z := o.Z + t*dir.Z
+	if x*x+z*z > radius*radius {
+		return math.Inf(1)
+	}
+
+	return t
+}
+
+// fills rec for a hit on a horizontal cap at local position p
+func (rec *HitRecord) set_cap(ray *Line, t float64, p vec3.Vec3, radius float64, normal_y float64, mat *Material, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3) {
+	phi := azimuth(p.X, p.Z)
+	dist := math.Sqrt(p.X*p.X + p.Z*p.Z)
+	dpdu := vec3.Vec3{-2 * math.Pi * p.Z, 0, 2 * math.Pi * p.X}
+	dpdv := vec3.Vec3{radius * math.Cos(phi), 0, radius * math.Sin(phi)}
+	rec.set(ray, t, vec3.Vec3{0, normal_y, 0}, phi/(2*math.Pi), dist/radius, dpdu, dpdv, mat, pdf)
+}
+
+func (c *Cylinder) Hit(ray *Line, rec *HitRecord) bool {
+	o := ray.Origin
+	o.Sub(c.Origin)
+	d := ray.Dir
+
+	const (
+		none = iota
+		side
+		bottom
+		top
+	)
+	best := rec.T
+	part := none
+
+	// side: x^2 + z^2 = r^2 with 0 <= y <= height
+	roots := solve_quadratic(d.X*d.X+d.Z*d.Z, 2*(o.X*d.X+o.Z*d.Z), o.X*o.X+o.Z*o.Z-c.Radius*c.Radius)
+	for _, t := range roots {
+		y := o.Y + t*d.Y
+		if t > hit_epsilon && t < best && y >= 0 && y <= c.Height {
+			best, part = t, side
+			break
+		}
+	}
+
+	if t := cap_distance(o, d, 0, c.Radius); t > hit_epsilon && t < best {
+		best, part = t, bottom
+	}
+
+	if t := cap_distance(o, d, c.Height, c.Radius); t > hit_epsilon && t < best {
+		best, part = t, top
+	}
+
+	p := d
+	p.Scale(best)
+	p.Add(o)
+
+	switch part {
+	case side:
+		normal := vec3.Vec3{p.X / c.Radius, 0, p.Z / c.Radius}
+		dpdu := vec3.Vec3{-2 * math.Pi * p.Z, 0, 2 * math.Pi * p.X}
+		dpdv := vec3.Vec3{0, c.Height, 0}
+		rec.set(ray, best, normal, azimuth(p.X, p.Z)/(2*math.Pi), p.Y/c.Height, dpdu, dpdv, &c.Mterial, c.Pdf)
+	case bottom:
+		rec.set_cap(ray, best, p, c.Radius, -1, &c.Mterial, c.Pdf)
+	case top:
+		rec.set_cap(ray, best, p, c.Radius, 1, &c.Mterial, c.Pdf)
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (c *Cylinder) Bounds() Aabb {
+	box := Aabb{c.Origin, c.Origin}
+	box.Min.Sub(vec3.Vec3{c.Radius, 0, c.Radius})
+	box.Max.Add(vec3.Vec3{c.Radius, c.Height, c.Radius})
+	return box
+}
+
+func (c *Cylinder) Area() float64 {
+	return 2*math.Pi*c.Radius*c.Height + 2*math.Pi*c.Radius*c.Radius
+}
+
+func (c *Cylinder) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	side := 2 * math.Pi * c.Radius * c.Height / c.Area()
+	cap := (1 - side) / 2
+	phi := 2 * math.Pi * u2
+
+	var p, n vec3.Vec3
+	if u1 < side {
+		// reuse u1 for the height
+		p = vec3.Vec3{c.Radius * math.Cos(phi), u1 / side * c.Height, c.Radius * math.Sin(phi)}
+		n = vec3.Vec3{math.Cos(phi), 0, math.Sin(phi)}
+	} else {
+		u1 -= side
+		y, ny := 0.0, -1.0
+		if u1 >= cap {
+			u1 -= cap
+			y, ny = c.Height, 1.0
+		}
+		dist := c.Radius * math.Sqrt(math.Min(1, u1/cap))
+		p = vec3.Vec3{dist * math.Cos(phi), y, dist * math.Sin(phi)}
+		n = vec3.Vec3{0, ny, 0}
+	}
+
+	p.Add(c.Origin)
+	return p, n
+}
+
+func (c *Cone) Hit(ray *Line, rec *HitRecord) bool {
+	o := ray.Origin
+	o.Sub(c.Origin)
+	d := ray.Dir
+
+	best := rec.T
+	side := false
+	base := false
+
+	// side: x^2 + z^2 = (k*(height - y))^2 with 0 <= y <= height
+	k := c.Radius / c.Height
+	k2 := k * k
+	h := c.Height - o.Y
+	roots := solve_quadratic(d.X*d.X+d.Z*d.Z-k2*d.Y*d.Y, 2*(o.X*d.X+o.Z*d.Z+k2*h*d.Y), o.X*o.X+o.Z*o.Z-k2*h*h)
+	for _, t := range roots {
+		y := o.Y + t*d.Y
+		if t > hit_epsilon && t < best && y >= 0 && y <= c.Height {
+			best, side = t, true
+			break
+		}
+	}
+
+	if t := cap_distance(o, d, 0, c.Radius); t > hit_epsilon && t < best {
+		best, side, base = t, false, true
+	}
+
+	if !side && !base {
+		return false
+	}
+
+	p := d
+	p.Scale(best)
+	p.Add(o)
+
+	if base {
+		rec.set_cap(ray, best, p, c.Radius, -1, &c.Mterial, c.Pdf)
+		return true
+	}
+
+	// gradient of the implicit surface
+	normal := vec3.Vec3{p.X, k2 * (c.Height - p.Y), p.Z}
+	normal.Normalize()
+	phi := azimuth(p.X, p.Z)
+	dpdu := vec3.Vec3{-2 * math.Pi * p.Z, 0, 2 * math.Pi * p.X}
+	dpdv := vec3.Vec3{-c.Radius * math.Cos(phi), c.Height, -c.Radius * math.Sin(phi)}
+	rec.set(ray, best, normal, phi/(2*math.Pi), p.Y/c.Height, dpdu, dpdv, &c.Mterial, c.Pdf)
+	return true
+}
+
+func (c *Cone) Bounds() Aabb {
+	box := Aabb{c.Origin, c.Origin}
+	box.Min.Sub(vec3.Vec3{c.Radius, 0, c.Radius})
+	box.Max.Add(vec3.Vec3{c.Radius, c.Height, c.Radius})
+	return box
+}
+
+func (c *Cone) Area() float64 {
+	return math.Pi*c.Radius*math.Sqrt(c.Radius*c.Radius+c.Height*c.Height) + math.Pi*c.Radius*c.Radius
+}
+
+func (c *Cone) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	side := math.Pi * c.Radius * math.Sqrt(c.Radius*c.Radius+c.Height*c.Height) / c.Area()
+	phi := 2 * math.Pi * u2
+
+	var p, n vec3.Vec3
+	if u1 < side {
+		// the circumference shrinks linearly towards the apex
+		v := 1 - math.Sqrt(1-u1/side)
+		r := c.Radius * (1 - v)
+		p = vec3.Vec3{r * math.Cos(phi), v * c.Height, r * math.Sin(phi)}
+		n = vec3.Vec3{c.Height * math.Cos(phi), c.Radius, c.Height * math.Sin(phi)}
+		n.Normalize()
+	} else {
+		dist := c.Radius * math.Sqrt(math.Min(1, (u1-side)/(1-side)))
+		p = vec3.Vec3{dist * math.Cos(phi), 0, dist * math.Sin(phi)}
+		n = vec3.Vec3{0, -1, 0}
+	}
+
+	p.Add(c.Origin)
+	return p, n
+}
+
+func (tor *Torus) Hit(ray *Line, rec *HitRecord) bool {
+	o := ray.Origin
+	o.Sub(tor.Origin)
+	d := ray.Dir
+
+	// only search the stretch of the ray inside the bounding sphere
+	outer := tor.Major + tor.Minor
+	roots := solve_quadratic(d.Dot(d), 2*o.Dot(d), o.Dot(o)-outer*outer)
+	if len(roots) < 2 {
+		return false
+	}
+	lo := math.Max(roots[0], hit_epsilon)
+	hi := math.Min(roots[1], rec.T)
+	if lo >= hi {
+		return false
+	}
+
+	// (|p|^2 + R^2 - r^2)^2 = 4 R^2 (x^2 + z^2) with p = o + t*d
+	R2 := tor.Major * tor.Major
+	m := d.Dot(d)
+	n := o.Dot(d)
+	k := o.Dot(o) + R2 - tor.Minor*tor.Minor
+	a := d.X*d.X + d.Z*d.Z
+	b := o.X*d.X + o.Z*d.Z
+	c := o.X*o.X + o.Z*o.Z
+	coeffs := []float64{
+		m * m,
+		4 * m * n,
+		4*n*n + 2*m*k - 4*R2*a,
+		4*n*k - 8*R2*b,
+		k*k - 4*R2*c,
+	}
+
+	ts := solve_poly(coeffs, lo, hi)
+	if len(ts) == 0 {
+		return false
+	}
+	t := ts[0]
+
+	p := d
+	p.Scale(t)
+	p.Add(o)
+
+	// gradient of the implicit surface
+	s := p.Dot(p) + R2 - tor.Minor*tor.Minor
+	normal := vec3.Vec3{p.X * (s - 2*R2), p.Y * s, p.Z * (s - 2*R2)}
+	normal.Normalize()
+
+	// u goes around the y axis, v around the tube
+	phi := azimuth(p.X, p.Z)
+	theta := math.Atan2(p.Y, math.Sqrt(p.X*p.X+p.Z*p.Z)-tor.Major)
+	if theta < 0 {
+		theta += 2 * math.Pi
+	}
+	ring := tor.Major + tor.Minor*math.Cos(theta)
+	dpdu := vec3.Vec3{-2 * math.Pi * ring * math.Sin(phi), 0, 2 * math.Pi * ring * math.Cos(phi)}
+	dpdv := vec3.Vec3{
+		-2 * math.Pi * tor.Minor * math.Sin(theta) * math.Cos(phi),
+		2 * math.Pi * tor.Minor * math.Cos(theta),
+		-2 * math.Pi * tor.Minor * math.Sin(theta) * math.Sin(phi),
+	}
+
+	rec.set(ray, t, normal, phi/(2*math.Pi), theta/(2*math.Pi), dpdu, dpdv, &tor.Mterial, tor.Pdf)
+	return true
+}
+
+func (tor *Torus) Bounds() Aabb {
+	outer := tor.Major + tor.Minor
+	box := Aabb{tor.Origin, tor.Origin}
+	box.Min.Sub(vec3.Vec3{outer, tor.Minor, outer})
+	box.Max.Add(vec3.Vec3{outer, tor.Minor, outer})
+	return box
+}
+
+func (tor *Torus) Area() float64 {
+	return 4 * math.Pi * math.Pi * tor.Major * tor.Minor
+}
+
+func (tor *Torus) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	// the area element grows with the distance to the axis, R + r*cos(theta).
+	// invert its cdf (R*theta + r*sin(theta)) / (2*pi*R) by bisection
+	lo, hi := 0.0, 2*math.Pi
+	for i := 0; i < 40; i++ {
+		theta := 0.5 * (lo + hi)
+		if (tor.Major*theta+tor.Minor*math.Sin(theta))/(2*math.Pi*tor.Major) < u1 {
+			lo = theta
+		} else {
+			hi = theta
+		}
+	}
+	theta := 0.5 * (lo + hi)
+	phi := 2 * math.Pi * u2
+
+	n := vec3.Vec3{math.Cos(theta) * math.Cos(phi), math.Sin(theta), math.Cos(theta) * math.Sin(phi)}
+	ring := tor.Major + tor.Minor*math.Cos(theta)
+	p := vec3.Vec3{ring * math.Cos(phi), tor.Minor * math.Sin(theta), ring * math.Sin(phi)}
+	p.Add(tor.Origin)
+	return p, n
+}
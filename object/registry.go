@@ -0,0 +1,121 @@
+package object
+
+import (
+	"fmt"
+	"github.com/supermuesli/pathtracer/vec3"
+	"sort"
+)
+
+// numeric parameters of a shape by name, one number for scalars and three
+// for vectors, e.g. {"origin": {0, 0, 0}, "radius": {1}}
+type Params map[string][]float64
+
+func (p Params) Float(name string) (float64, error) {
+	v, ok := p[name]
+	if !ok || len(v) != 1 {
+		return 0, fmt.Errorf("parameter %q needs 1 number", name)
+	}
+	return v[0], nil
+}
+
+func (p Params) Vec(name string) (vec3.Vec3, error) {
+	v, ok := p[name]
+	if !ok || len(v) != 3 {
+		return vec3.Vec3{}, fmt.Errorf("parameter %q needs 3 numbers", name)
+	}
+	return vec3.Vec3{v[0], v[1], v[2]}, nil
+}
+
+// builds a shape of some type from its parameters, the pdf that picks its
+// bounce directions and its material
+type Constructor func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error)
+
+var constructors = map[string]Constructor{}
+
+// makes a shape type available by name, so that scenes can be built from
+// a description that only names it. packages with their own shapes call
+// this in an init function. registering a name twice replaces the first
+func Register(name string, ctor Constructor) {
+	constructors[name] = ctor
+}
+
+// builds a shape of the type registered under name
+func New_shape(name string, p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+	ctor, ok := constructors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown shape %q", name)
+	}
+	return ctor(p, pdf, m)
+}
+
+// names of all registered shape types in alphabetical order
+func Shape_names() []string {
+	var names []string
+	for name := range constructors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reads parameters and keeps the first error, so constructors can check
+// once at the end
+type param_reader struct {
+	p Params
+	err error
+}
+
+func (r *param_reader) float(name string) float64 {
+	v, err := r.p.Float(name)
+	if r.err == nil {
+		r.err = err
+	}
+	return v
+}
+
+func (r *param_reader) vec(name string) vec3.Vec3 {
+	v, err := r.p.Vec(name)
+	if r.err == nil {
+		r.err = err
+	}
+	return v
+}
+
+// the built in shapes
+func init() {
+	Register("sphere", func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+		r := param_reader{p: p}
+		s := &Sphere{Origin: r.vec("origin"), Radius: r.float("radius"), Pdf: pdf, Mterial: m}
+		return s, r.err
+	})
+	Register("plane", func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+		r := param_reader{p: p}
+		s := &Plane{Point: r.vec("point"), Normal: r.vec("normal"), Pdf: pdf, Mterial: m}
+		return s, r.err
+	})
+	Register("quad", func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+		r := param_reader{p: p}
+		s := &Quad{Corner: r.vec("corner"), U: r.vec("u"), V: r.vec("v"), Pdf: pdf, Mterial: m}
+		return s, r.err
+	})
+	Register("disk", func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+		r := param_reader{p: p}
+		s := &Disk{Center: r.vec("center"), Normal: r.vec("normal"), Radius: r.float("radius"), Pdf: pdf, Mterial: m}
+		return s, r.err
+	})
+	Register("cylinder", func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+		r := param_reader{p: p}
+		s := &Cylinder{Origin: r.vec("origin"), Radius: r.float("radius"), Height: r.float("height"), Pdf: pdf, Mterial: m}
+		return s, r.err
+	})
+	Register("cone", func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+		r := param_reader{p: p}
+		s := &Cone{Origin: r.vec("origin"), Radius: r.float("radius"), Height: r.float("height"), Pdf: pdf, Mterial: m}
+		return s, r.err
+	})
+	Register("torus", func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+		r := param_reader{p: p}
+		s := &Torus{Origin: r.vec("origin"), Major: r.float("major"), Minor: r.float("minor"), Pdf: pdf, Mterial: m}
+		return s, r.err
+	})
+}
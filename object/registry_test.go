@@ -0,0 +1,59 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"testing"
+)
+
+func Test_new_shape(t *testing.T) {
+	m := Material{Diffuse_color: vec3.Vec3{1, 0, 0}}
+	s, err := New_shape("sphere", Params{"origin": {1, 2, 3}, "radius": {4}}, nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sphere, ok := s.(*Sphere)
+	if !ok || sphere.Origin != (vec3.Vec3{1, 2, 3}) || sphere.Radius != 4 || sphere.Mterial.Diffuse_color != m.Diffuse_color {
+		t.Errorf("built %#v", s)
+	}
+
+	if _, err := New_shape("teapot", Params{}, nil, m); err == nil {
+		t.Error("built a shape that was never registered")
+	}
+	// the radius is a scalar
+	if _, err := New_shape("sphere", Params{"origin": {0, 0, 0}, "radius": {1, 2, 3}}, nil, m); err == nil {
+		t.Error("built a sphere with a vector radius")
+	}
+	if _, err := New_shape("torus", Params{"origin": {0, 0, 0}, "major": {2}}, nil, m); err == nil {
+		t.Error("built a torus without a minor radius")
+	}
+}
+
+// a shape from outside of the package, a square of a given size
+type square struct {
+	Quad
+}
+
+func Test_register(t *testing.T) {
+	Register("square", func(p Params, pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3, m Material) (Shape, error) {
+		size, err := p.Float("size")
+		return &square{Quad{Corner: vec3.Vec3{0, 0, 0}, U: vec3.Vec3{size, 0, 0}, V: vec3.Vec3{0, size, 0}, Pdf: pdf, Mterial: m}}, err
+	})
+	defer delete(constructors, "square")
+
+	s, err := New_shape("square", Params{"size": {2}}, nil, Material{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(s.Area()-4) > 1e-12 {
+		t.Errorf("area %v, want 4", s.Area())
+	}
+
+	found := false
+	for _, name := range Shape_names() {
+		found = found || name == "square"
+	}
+	if !found {
+		t.Errorf("square isn't among %v", Shape_names())
+	}
+}
@@ -0,0 +1,228 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// anything a ray can hit. the renderer only ever talks to primitives
+// through this interface, so new primitive types just need to implement it.
+// Register makes them available by name as well
+type Shape interface {
+	// fills rec and returns true if the ray hits the shape closer than rec.T
+	Hit(ray *Line, rec *HitRecord) bool
+	// world space bounds
+	Bounds() Aabb
+	// surface area
+	Area() float64
+	// maps two uniform random numbers in [0, 1) to a uniformly distributed
+	// point on the surface and returns the point and the surface normal there
+	Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3)
+}
+
+// shapes of a single material, like spheres and the analytic primitives
+type Single_material interface {
+	Shape
+	Material() *Material
+}
+
+func (s *Sphere) Material() *Material {
+	return &s.Mterial
+}
+
+func (t *Triangle) Bounds() Aabb {
+	box := Empty_aabb()
+	box.Extend(t.A)
+	box.Extend(t.B)
+	box.Extend(t.C)
+	return box
+}
+
+func (t *Triangle) Area() float64 {
+	e1 := t.B
+	e1.Sub(t.A)
+	e2 := t.C
+	e2.Sub(t.A)
+	e1.Cross(e2)
+	return 0.5 * e1.Euclidean_norm()
+}
+
+func (t *Triangle) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	// fold the unit square onto the triangle
+	su := math.Sqrt(u1)
+	b := su * (1 - u2)
+	c := su * u2
+
+	p := t.A
+	p.Scale(1 - b - c)
+	pb := t.B
+	pb.Scale(b)
+	pc := t.C
+	pc.Scale(c)
+	p.Add(pb)
+	p.Add(pc)
+
+	return p, t.Normal(b, c)
+}
+
+func (s *Sphere) Bounds() Aabb {
+	r := vec3.Vec3{s.Radius, s.Radius, s.Radius}
+	box := Aabb{s.Origin, s.Origin}
+	box.Min.Sub(r)
+	box.Max.Add(r)
+	return box
+}
+
+func (s *Sphere) Area() float64 {
+	return 4 * math.Pi * s.Radius * s.Radius
+}
+
+func (s *Sphere) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	z := 1 - 2*u1
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * u2
+	normal := vec3.Vec3{r * math.Cos(phi), r * math.Sin(phi), z}
+
+	p := normal
+	p.Scale(s.Radius)
+	p.Add(s.Origin)
+	return p, normal
+}
+
+// sorts the triangles of the mesh into a bvh so that rays only test the
+// ones they might hit. has to be called again after the mesh changed
+func (o *Object) Update_bounds() {
+	shapes := make([]Shape, len(o.Mesh))
+	for i := 0; i < len(o.Mesh); i++ {
+		shapes[i] = &o.Mesh[i]
+	}
+	o.bvh = New_bvh(shapes)
+}
+
+func (o *Object) Hit(ray *Line, rec *HitRecord) bool {
+	if o.bvh != nil {
+		j := o.bvh.Hit(ray, rec)
+		if j < 0 {
+			return false
+		}
+		rec.Prim_id = j
+		return true
+	}
+
+	hit := false
+	for j := 0; j < len(o.Mesh); j++ {
+		// only keeps the closest intersections
+		if o.Mesh[j].Hit(ray, rec) {
+			rec.Prim_id = j
+			hit = true
+		}
+	}
+
+	return hit
+}
+
+func (o *Object) Bounds() Aabb {
+	box := Empty_aabb()
+	for i := 0; i < len(o.Mesh); i++ {
+		box.Extend(o.Mesh[i].A)
+		box.Extend(o.Mesh[i].B)
+		box.Extend(o.Mesh[i].C)
+	}
+
+	return box
+}
+
+func (o *Object) Area() float64 {
+	area := 0.0
+	for i := 0; i < len(o.Mesh); i++ {
+		area += o.Mesh[i].Area()
+	}
+
+	return area
+}
+
+func (o *Object) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	// pick a triangle proportional to its area and reuse u1 within it
+	target := u1 * o.Area()
+	for i := 0; i < len(o.Mesh); i++ {
+		area := o.Mesh[i].Area()
+		if target < area || i == len(o.Mesh)-1 {
+			return o.Mesh[i].Sample(math.Min(target/area, 1), u2)
+		}
+		target -= area
+	}
+
+	return vec3.Vec3{0, 0, 0}, vec3.Vec3{0, 0, 0}
+}
+
+// a shape placed in the world by a (possibly moving) transform. this is
+// how instanced and animated geometry is intersected: rays are moved into
+// the shape's object space instead of moving the shape
+type Transformed struct {
+	Shape Shape
+	Motion *Motion
+	inverse Transform
+	box Aabb
+}
+
+func New_transformed(shape Shape, motion *Motion) *Transformed {
+	t := &Transformed{Shape: shape, Motion: motion, inverse: motion.Xforms[0].Inverse()}
+
+	// points move linearly between the motion samples, so bounding the
+	// transformed corners at every sample bounds the whole motion
+	local := shape.Bounds()
+	t.box = Empty_aabb()
+	for k := 0; k < len(motion.Xforms); k++ {
+		for c := 0; c < 8; c++ {
+			corner := local.Min
+			if c&1 != 0 {
+				corner.X = local.Max.X
+			}
+			if c&2 != 0 {
+				corner.Y = local.Max.Y
+			}
+			if c&4 != 0 {
+				corner.Z = local.Max.Z
+			}
+			t.box.Extend(motion.Xforms[k].Apply_point(corner))
+		}
+	}
+
+	return t
+}
+
+func (t *Transformed) Hit(ray *Line, rec *HitRecord) bool {
+	if !t.box.Intersects(ray) {
+		return false
+	}
+
+	xform := t.Motion.Xforms[0]
+	inverse := t.inverse
+	if len(t.Motion.Xforms) > 1 {
+		xform = t.Motion.At(ray.Time)
+		inverse = xform.Inverse()
+	}
+
+	local_ray := inverse.Apply_line(ray)
+	if !t.Shape.Hit(&local_ray, rec) {
+		return false
+	}
+
+	rec.Transform(xform)
+	return true
+}
+
+func (t *Transformed) Bounds() Aabb {
+	return t.box
+}
+
+// area at shutter open, exact for rigid motion and uniform scaling
+func (t *Transformed) Area() float64 {
+	return t.Shape.Area() * math.Pow(math.Abs(t.Motion.Xforms[0].Det()), 2.0/3.0)
+}
+
+// samples the shape where it is at shutter open
+func (t *Transformed) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	p, n := t.Shape.Sample(u1, u2)
+	return t.Motion.Xforms[0].Apply_point(p), t.inverse.apply_transposed(n)
+}
@@ -0,0 +1,113 @@
+package object
+
+import (
+	"math"
+)
+
+// returns the real roots of a*t^2 + b*t + c in ascending order
+func solve_quadratic(a float64, b float64, c float64) []float64 {
+	if a == 0 {
+		if b == 0 {
+			return nil
+		}
+		return []float64{-c / b}
+	}
+
+	disc := b*b - 4*a*c
+	if disc < 0 {
+		return nil
+	}
+
+	// numerically stable variant, avoids cancellation in -b + sqrt(disc)
+	q := -0.5 * (b + math.Copysign(math.Sqrt(disc), b))
+	t0 := q / a
+	t1 := t0
+	if q != 0 {
+		t1 = c / q
+	}
+
+	if t0 > t1 {
+		t0, t1 = t1, t0
+	}
+	return []float64{t0, t1}
+}
+
+// evaluates the polynomial with coefficients c (highest degree first) at t
+func eval_poly(c []float64, t float64) float64 {
+	res := 0.0
+	for i := 0; i < len(c); i++ {
+		res = res*t + c[i]
+	}
+
+	return res
+}
+
+// returns the real roots of the polynomial c (highest degree first) within
+// [lo, hi] in ascending order. the roots of the derivative split the
+// interval into monotonic pieces, each of which contains at most one root
+// that is then found by bisection
+func solve_poly(c []float64, lo float64, hi float64) []float64 {
+	// strip vanishing leading coefficients
+	for len(c) > 0 && c[0] == 0 {
+		c = c[1:]
+	}
+
+	if len(c) <= 1 {
+		return nil
+	}
+
+	if len(c) == 3 {
+		var res []float64
+		for _, t := range solve_quadratic(c[0], c[1], c[2]) {
+			if t >= lo && t <= hi {
+				res = append(res, t)
+			}
+		}
+		return res
+	}
+
+	if len(c) == 2 {
+		t := -c[1] / c[0]
+		if t >= lo && t <= hi {
+			return []float64{t}
+		}
+		return nil
+	}
+
+	degree := len(c) - 1
+	derivative := make([]float64, degree)
+	for i := 0; i < degree; i++ {
+		derivative[i] = c[i] * float64(degree-i)
+	}
+
+	bounds := append([]float64{lo}, solve_poly(derivative, lo, hi)...)
+	bounds = append(bounds, hi)
+
+	var res []float64
+	for i := 0; i+1 < len(bounds); i++ {
+		a, b := bounds[i], bounds[i+1]
+		fa, fb := eval_poly(c, a), eval_poly(c, b)
+		if fa == 0 {
+			if len(res) == 0 || res[len(res)-1] != a {
+				res = append(res, a)
+			}
+			continue
+		}
+		if fa*fb > 0 {
+			continue
+		}
+
+		for iter := 0; iter < 64 && b-a > 1e-12*math.Max(1, math.Abs(a)); iter++ {
+			m := 0.5 * (a + b)
+			fm := eval_poly(c, m)
+			if fa*fm <= 0 {
+				b = m
+			} else {
+				a, fa = m, fm
+			}
+		}
+		res = append(res, 0.5*(a+b))
+	}
+
+	return res
+}
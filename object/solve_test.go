@@ -0,0 +1,123 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"testing"
+)
+
+func near_roots(a []float64, b []float64, eps float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > eps {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_solve_quadratic(t *testing.T) {
+	// (t - 1)(t - 3)
+	if roots := solve_quadratic(1, -4, 3); !near_roots(roots, []float64{1, 3}, 1e-12) {
+		t.Errorf("roots %v, want [1 3]", roots)
+	}
+	// t^2 + 1
+	if roots := solve_quadratic(1, 0, 1); len(roots) != 0 {
+		t.Errorf("roots %v, want none", roots)
+	}
+	// 2t - 4, degenerate
+	if roots := solve_quadratic(0, 2, -4); !near_roots(roots, []float64{2}, 0) {
+		t.Errorf("roots %v, want [2]", roots)
+	}
+	// roots far apart, the small one cancels in the textbook formula
+	if roots := solve_quadratic(1, -(1e8 + 1e-8), 1); len(roots) != 2 || math.Abs(roots[0]/1e-8-1) > 1e-12 || math.Abs(roots[1]/1e8-1) > 1e-12 {
+		t.Errorf("roots %v, want [1e-8 1e8]", roots)
+	}
+}
+
+func Test_solve_poly(t *testing.T) {
+	// (t - 1)(t - 2)(t - 3)(t - 4)
+	quartic := []float64{1, -10, 35, -50, 24}
+	if roots := solve_poly(quartic, 0, 5); !near_roots(roots, []float64{1, 2, 3, 4}, 1e-9) {
+		t.Errorf("roots %v, want [1 2 3 4]", roots)
+	}
+	// only the roots within the interval
+	if roots := solve_poly(quartic, 2.5, 10); !near_roots(roots, []float64{3, 4}, 1e-9) {
+		t.Errorf("roots in [2.5, 10] %v, want [3 4]", roots)
+	}
+	// t^4 + 1
+	if roots := solve_poly([]float64{1, 0, 0, 0, 1}, -10, 10); len(roots) != 0 {
+		t.Errorf("roots %v, want none", roots)
+	}
+	// vanishing leading coefficients leave a cubic, (t + 2)(t - 0.5)(t - 7)
+	if roots := solve_poly([]float64{0, 0, 1, -5.5, -11.5, 7}, -5, 10); !near_roots(roots, []float64{-2, 0.5, 7}, 1e-9) {
+		t.Errorf("roots %v, want [-2 0.5 7]", roots)
+	}
+}
+
+func Test_torus_hit(t *testing.T) {
+	// lies in the xz plane around the y axis, reaches from 2 to 4
+	tor := &Torus{Origin: vec3.Vec3{0, 0, 0}, Major: 3, Minor: 1}
+
+	for _, c := range []struct {
+		name string
+		origin, dir vec3.Vec3
+		t float64
+		normal vec3.Vec3
+	}{
+		{"outside", vec3.Vec3{-10, 0, 0}, vec3.Vec3{1, 0, 0}, 6, vec3.Vec3{-1, 0, 0}},
+		{"from the hole", vec3.Vec3{0, 0, 0}, vec3.Vec3{1, 0, 0}, 2, vec3.Vec3{-1, 0, 0}},
+		{"top of the tube", vec3.Vec3{0, 10, 3}, vec3.Vec3{0, -1, 0}, 9, vec3.Vec3{0, 1, 0}},
+		// object space rays of scaled shapes aren't normalized
+		{"unnormalized", vec3.Vec3{-10, 0, 0}, vec3.Vec3{2, 0, 0}, 3, vec3.Vec3{-1, 0, 0}},
+	} {
+		rec := New_hit_record()
+		if !tor.Hit(&Line{c.origin, c.dir, 0}, &rec) {
+			t.Errorf("%s: missed", c.name)
+			continue
+		}
+		if math.Abs(rec.T-c.t) > 1e-9 || !near_vec(rec.Geometric_normal, c.normal, 1e-6) {
+			t.Errorf("%s: hit at %v with normal %v, want %v with %v", c.name, rec.T, rec.Geometric_normal, c.t, c.normal)
+		}
+		if !rec.Front_face {
+			t.Errorf("%s: hit the inside of the tube", c.name)
+		}
+	}
+
+	// straight through the hole
+	rec := New_hit_record()
+	if tor.Hit(&Line{vec3.Vec3{0, 10, 0}, vec3.Vec3{0, -1, 0}, 0}, &rec) {
+		t.Errorf("hit the hole at %v", rec.T)
+	}
+
+	// hits behind a closer one are ignored
+	rec = New_hit_record()
+	rec.T = 5
+	if tor.Hit(&Line{vec3.Vec3{-10, 0, 0}, vec3.Vec3{1, 0, 0}, 0}, &rec) {
+		t.Errorf("replaced a closer hit with one at %v", rec.T)
+	}
+}
+
+func Test_torus_sample(t *testing.T) {
+	tor := &Torus{Origin: vec3.Vec3{1, 2, 3}, Major: 3, Minor: 1}
+	for i := 0; i < 100; i++ {
+		p, n := tor.Sample(float64(i)/100, math.Mod(float64(i)*0.618, 1))
+
+		// a point on the tube, with the normal pointing away from the ring
+		p.Sub(tor.Origin)
+		ring := vec3.Vec3{p.X, 0, p.Z}
+		ring.Normalize()
+		ring.Scale(tor.Major)
+		out := p
+		out.Sub(ring)
+		if math.Abs(out.Euclidean_norm()-tor.Minor) > 1e-6 {
+			t.Fatalf("sample %v is %v off the surface", p, out.Euclidean_norm()-tor.Minor)
+		}
+		out.Normalize()
+		if !near_vec(out, n, 1e-6) {
+			t.Fatalf("normal %v at %v, want %v", n, p, out)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// affine transformation stored as a row-major 4x4 matrix
+type Transform struct {
+	M [4][4]float64
+}
+
+func Identity() Transform {
+	return Transform{[4][4]float64{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}}
+}
+
+func Translation(x float64, y float64, z float64) Transform {
+	t := Identity()
+	t.M[0][3] = x
+	t.M[1][3] = y
+	t.M[2][3] = z
+	return t
+}
+
+func Scaling(x float64, y float64, z float64) Transform {
+	t := Identity()
+	t.M[0][0] = x
+	t.M[1][1] = y
+	t.M[2][2] = z
+	return t
+}
+
+// rotations follow the same conventions as vec3.Rotate_x/y/z
+func Rotation_x(theta float64) Transform {
+	t := Identity()
+	c, s := math.Cos(theta), math.Sin(theta)
+	t.M[1][1], t.M[1][2] = c, -s
+	t.M[2][1], t.M[2][2] = s, c
+	return t
+}
+
+func Rotation_y(theta float64) Transform {
+	t := Identity()
+	c, s := math.Cos(theta), math.Sin(theta)
+	t.M[0][0], t.M[0][2] = c, s
+	t.M[2][0], t.M[2][2] = -s, c
+	return t
+}
+
+func Rotation_z(theta float64) Transform {
+	t := Identity()
+	c, s := math.Cos(theta), math.Sin(theta)
+	t.M[0][0], t.M[0][1] = c, -s
+	t.M[1][0], t.M[1][1] = s, c
+	return t
+}
+
+// returns a*b, i.e. b is applied first and a second
+func (a Transform) Mul(b Transform) Transform {
+	var res Transform
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				res.M[i][j] += a.M[i][k] * b.M[k][j]
+			}
+		}
+	}
+
+	return res
+}
+
+func (a Transform) Apply_point(p vec3.Vec3) vec3.Vec3 {
+	return vec3.Vec3{
+		a.M[0][0]*p.X + a.M[0][1]*p.Y + a.M[0][2]*p.Z + a.M[0][3],
+		a.M[1][0]*p.X + a.M[1][1]*p.Y + a.M[1][2]*p.Z + a.M[1][3],
+		a.M[2][0]*p.X + a.M[2][1]*p.Y + a.M[2][2]*p.Z + a.M[2][3],
+	}
+}
+
+// like Apply_point but ignores the translation
+func (a Transform) Apply_vector(v vec3.Vec3) vec3.Vec3 {
+	return vec3.Vec3{
+		a.M[0][0]*v.X + a.M[0][1]*v.Y + a.M[0][2]*v.Z,
+		a.M[1][0]*v.X + a.M[1][1]*v.Y + a.M[1][2]*v.Z,
+		a.M[2][0]*v.X + a.M[2][1]*v.Y + a.M[2][2]*v.Z,
+	}
+}
+
+// determinant of the upper 3x3 (linear) part
+func (a Transform) Det() float64 {
+	m := a.M
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// inverse of an affine transform, the last row is assumed to be 0 0 0 1
+func (a Transform) Inverse() Transform {
+	m := a.M
+	inv_det := 1.0 / a.Det()
+
+	res := Identity()
+	res.M[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) * inv_det
+	res.M[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) * inv_det
+	res.M[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) * inv_det
+	res.M[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) * inv_det
+	res.M[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) * inv_det
+	res.M[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) * inv_det
+	res.M[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) * inv_det
+	res.M[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) * inv_det
+	res.M[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) * inv_det
+
+	// translation part is -R^-1 * t
+	t := res.Apply_vector(vec3.Vec3{m[0][3], m[1][3], m[2][3]})
+	res.M[0][3] = -t.X
+	res.M[1][3] = -t.Y
+	res.M[2][3] = -t.Z
+
+	return res
+}
+
+// transform object in 3d space
+func (o *Object) Transform(t Transform) {
+	inv := t.Inverse()
+	for i := 0; i < len(o.Mesh); i++ {
+		o.Mesh[i].A = t.Apply_point(o.Mesh[i].A)
+		o.Mesh[i].B = t.Apply_point(o.Mesh[i].B)
+		o.Mesh[i].C = t.Apply_point(o.Mesh[i].C)
+
+		// vertex normals may be shared with other copies of the mesh, so
+		// they are replaced instead of modified in place
+		if o.Mesh[i].Normals != nil {
+			n := *o.Mesh[i].Normals
+			o.Mesh[i].Normals = &[3]vec3.Vec3{inv.apply_transposed(n[0]), inv.apply_transposed(n[1]), inv.apply_transposed(n[2])}
+		}
+	}
+}
+
+// transform sphere in 3d space. spheres stay spheres, so non-uniform
+// scaling is approximated by the average scale factor
+func (s *Sphere) Transform(t Transform) {
+	s.Origin = t.Apply_point(s.Origin)
+	s.Radius *= math.Cbrt(math.Abs(t.Det()))
+}
@@ -0,0 +1,45 @@
+package object
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"testing"
+)
+
+func near_vec(a vec3.Vec3, b vec3.Vec3, eps float64) bool {
+	return math.Abs(a.X-b.X) <= eps && math.Abs(a.Y-b.Y) <= eps && math.Abs(a.Z-b.Z) <= eps
+}
+
+func Test_inverse(t *testing.T) {
+	xform := Translation(10, -20, 30).Mul(Rotation_y(0.7)).Mul(Scaling(2, 0.5, 3)).Mul(Rotation_x(-1.2))
+	product := xform.Mul(xform.Inverse())
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			want := 0.0
+			if r == c {
+				want = 1
+			}
+			if math.Abs(product.M[r][c]-want) > 1e-12 {
+				t.Fatalf("xform * inverse is %v, want the identity", product.M)
+			}
+		}
+	}
+
+	// points go there and back again, the translation included
+	p := vec3.Vec3{3, -4, 5}
+	if q := xform.Inverse().Apply_point(xform.Apply_point(p)); !near_vec(q, p, 1e-9) {
+		t.Errorf("point %v came back as %v", p, q)
+	}
+}
+
+func Test_inverse_of_rotation_is_transpose(t *testing.T) {
+	rot := Rotation_z(0.4).Mul(Rotation_y(-2.1))
+	inv := rot.Inverse()
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			if math.Abs(inv.M[r][c]-rot.M[c][r]) > 1e-12 {
+				t.Fatalf("inverse %v isn't the transpose of %v", inv.M, rot.M)
+			}
+		}
+	}
+}
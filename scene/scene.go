@@ -0,0 +1,188 @@
+package scene
+
+import (
+	"github.com/supermuesli/pathtracer/anim"
+	"github.com/supermuesli/pathtracer/light"
+	"github.com/supermuesli/pathtracer/object"
+)
+
+// node in the scene graph. geometry is optional, so a node without mesh,
+// sphere or shape simply groups its children under a common transform
+type Node struct {
+	Name string
+	// transform relative to the parent node
+	Local object.Transform
+	Mesh *object.Object
+	Sphere *object.Sphere
+	// any other primitive, placed in the world by wrapping it in an
+	// object.Transformed. Mterial and Intensity don't apply to it
+	Shape object.Shape
+	// light source placed by this node's transform, see Lights
+	Light light.Light
+	// if set, overrides the material of this node's own geometry
+	Mterial *object.Material
+	// if set, animates the node in its local frame (applied before Local)
+	Animation *anim.Transform_track
+	// if set, animates the emission of this node's own geometry
+	Intensity *anim.Track
+	Children []*Node
+}
+
+func New_node(name string) *Node {
+	return &Node{Name: name, Local: object.Identity()}
+}
+
+// attaches children to the node and returns the node for chaining
+func (n *Node) Add(children ...*Node) *Node {
+	n.Children = append(n.Children, children...)
+	return n
+}
+
+// move node relative to its parent
+func (n *Node) Move(x float64, y float64, z float64) *Node {
+	n.Local = object.Translation(x, y, z).Mul(n.Local)
+	return n
+}
+
+// rotate node relative to its parent
+func (n *Node) Rotate_x(theta float64) *Node {
+	n.Local = object.Rotation_x(theta).Mul(n.Local)
+	return n
+}
+
+// rotate node relative to its parent
+func (n *Node) Rotate_y(theta float64) *Node {
+	n.Local = object.Rotation_y(theta).Mul(n.Local)
+	return n
+}
+
+// rotate node relative to its parent
+func (n *Node) Rotate_z(theta float64) *Node {
+	n.Local = object.Rotation_z(theta).Mul(n.Local)
+	return n
+}
+
+// scale node relative to its parent
+func (n *Node) Scale(x float64, y float64, z float64) *Node {
+	n.Local = object.Scaling(x, y, z).Mul(n.Local)
+	return n
+}
+
+// returns the node's transform relative to its parent at the given time
+func (n *Node) Local_at(time float64) object.Transform {
+	if n.Animation == nil {
+		return n.Local
+	}
+
+	return n.Local.Mul(n.Animation.At(time))
+}
+
+// number of world transforms sampled over the shutter interval for moving nodes
+const motion_steps = 8
+
+// composes the world transforms of the whole tree over the shutter interval
+// [open, close] and returns copies of all geometry in a bvh, whose Shapes
+// are the flat primitive list. meshes and spheres that don't move while the
+// shutter is open are baked into world space, everything else is wrapped
+// in an object.Transformed, which bounds its whole motion. the node's own
+// geometry is never modified, so the same mesh can be shared by several
+// nodes
+func (n *Node) Flatten(open float64, close float64) *object.Bvh {
+	var primitives []object.Shape
+
+	times := []float64{open}
+	if close > open {
+		times = make([]float64, motion_steps)
+		for i := 0; i < motion_steps; i++ {
+			times[i] = open + (close-open)*float64(i)/float64(motion_steps-1)
+		}
+	}
+
+	n.flatten([]object.Transform{object.Identity()}, times, &primitives)
+	return object.New_bvh(primitives)
+}
+
+// parent holds either a single static world transform or one per time sample
+func (n *Node) flatten(parent []object.Transform, times []float64, primitives *[]object.Shape) {
+	// a node moves if it or any of its ancestors is animated
+	samples := len(parent)
+	if n.Animation != nil {
+		samples = len(times)
+	}
+
+	world := make([]object.Transform, samples)
+	for i := 0; i < samples; i++ {
+		p := parent[0]
+		if len(parent) > 1 {
+			p = parent[i]
+		}
+		world[i] = p.Mul(n.Local_at(times[i]))
+	}
+
+	motion := &object.Motion{times[0], times[len(times)-1], world}
+	moving := len(world) > 1
+
+	if n.Mesh != nil {
+		mesh := &object.Object{Mesh: make([]object.Triangle, len(n.Mesh.Mesh))}
+		copy(mesh.Mesh, n.Mesh.Mesh)
+		for i := 0; i < len(mesh.Mesh); i++ {
+			if n.Mterial != nil {
+				mesh.Mesh[i].Mterial = *n.Mterial
+			}
+			if n.Intensity != nil {
+				mesh.Mesh[i].Mterial.Emission = n.Intensity.At(times[0])
+			}
+		}
+		if moving {
+			mesh.Update_bounds()
+			*primitives = append(*primitives, object.New_transformed(mesh, motion))
+		} else {
+			mesh.Transform(world[0])
+			mesh.Update_bounds()
+			*primitives = append(*primitives, mesh)
+		}
+	}
+
+	if n.Sphere != nil {
+		sphere := *n.Sphere
+		if n.Mterial != nil {
+			sphere.Mterial = *n.Mterial
+		}
+		if n.Intensity != nil {
+			sphere.Mterial.Emission = n.Intensity.At(times[0])
+		}
+		if moving {
+			*primitives = append(*primitives, object.New_transformed(&sphere, motion))
+		} else {
+			sphere.Transform(world[0])
+			*primitives = append(*primitives, &sphere)
+		}
+	}
+
+	if n.Shape != nil {
+		*primitives = append(*primitives, object.New_transformed(n.Shape, motion))
+	}
+
+	for i := 0; i < len(n.Children); i++ {
+		n.Children[i].flatten(world, times, primitives)
+	}
+}
+
+// returns copies of all light sources in the tree, placed in the world as
+// they are at the given time. lights don't move while the shutter is open
+func (n *Node) Lights(time float64) []light.Light {
+	var lights []light.Light
+	n.lights(object.Identity(), time, &lights)
+	return lights
+}
+
+func (n *Node) lights(parent object.Transform, time float64, lights *[]light.Light) {
+	world := parent.Mul(n.Local_at(time))
+	if n.Light != nil {
+		*lights = append(*lights, n.Light.Transform(world))
+	}
+
+	for i := 0; i < len(n.Children); i++ {
+		n.Children[i].lights(world, time, lights)
+	}
+}
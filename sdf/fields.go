@@ -0,0 +1,143 @@
+package sdf
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+func Sphere(center vec3.Vec3, radius float64) Field {
+	return func(p vec3.Vec3) float64 {
+		p.Sub(center)
+		return p.Euclidean_norm() - radius
+	}
+}
+
+// box around center, half holds half of the width, height and depth
+func Box(center vec3.Vec3, half vec3.Vec3) Field {
+	return func(p vec3.Vec3) float64 {
+		p.Sub(center)
+		q := vec3.Vec3{math.Abs(p.X) - half.X, math.Abs(p.Y) - half.Y, math.Abs(p.Z) - half.Z}
+		outside := vec3.Vec3{math.Max(q.X, 0), math.Max(q.Y, 0), math.Max(q.Z, 0)}
+		inside := math.Min(math.Max(q.X, math.Max(q.Y, q.Z)), 0)
+		return outside.Euclidean_norm() + inside
+	}
+}
+
+// torus around the y axis, see object.Torus
+func Torus(center vec3.Vec3, major float64, minor float64) Field {
+	return func(p vec3.Vec3) float64 {
+		p.Sub(center)
+		ring := math.Sqrt(p.X*p.X+p.Z*p.Z) - major
+		return math.Sqrt(ring*ring+p.Y*p.Y) - minor
+	}
+}
+
+func Union(fields ...Field) Field {
+	return func(p vec3.Vec3) float64 {
+		d := math.Inf(1)
+		for _, f := range fields {
+			d = math.Min(d, f(p))
+		}
+		return d
+	}
+}
+
+func Intersection(a Field, b Field) Field {
+	return func(p vec3.Vec3) float64 {
+		return math.Max(a(p), b(p))
+	}
+}
+
+// a with b cut out of it
+func Subtraction(a Field, b Field) Field {
+	return func(p vec3.Vec3) float64 {
+		return math.Max(a(p), -b(p))
+	}
+}
+
+// polynomial smooth minimum, blends a and b within a distance of k
+func Smooth_min(a float64, b float64, k float64) float64 {
+	h := math.Max(0, math.Min(1, 0.5+0.5*(b-a)/k))
+	return b + (a-b)*h - k*h*(1-h)
+}
+
+// union that blends the surfaces into each other within a distance of k
+func Smooth_union(a Field, b Field, k float64) Field {
+	return func(p vec3.Vec3) float64 {
+		return Smooth_min(a(p), b(p), k)
+	}
+}
+
+// blobby spheres that melt into each other within a distance of k
+func Metaballs(centers []vec3.Vec3, radii []float64, k float64) Field {
+	return func(p vec3.Vec3) float64 {
+		d := math.Inf(1)
+		for i := range centers {
+			q := p
+			q.Sub(centers[i])
+			ball := q.Euclidean_norm() - radii[i]
+			if math.IsInf(d, 1) {
+				d = ball
+			} else {
+				d = Smooth_min(d, ball, k)
+			}
+		}
+		return d
+	}
+}
+
+// infinitely repeats f with the given period along each axis. axes with a
+// period of 0 aren't repeated. f should fit into a single cell
+func Repeat(f Field, period vec3.Vec3) Field {
+	wrap := func(x float64, period float64) float64 {
+		if period == 0 {
+			return x
+		}
+		return x - period*math.Round(x/period)
+	}
+
+	return func(p vec3.Vec3) float64 {
+		return f(vec3.Vec3{wrap(p.X, period.X), wrap(p.Y, period.Y), wrap(p.Z, period.Z)})
+	}
+}
+
+// twists f around the y axis by k radians per unit of height. this bends
+// distances, so the surface needs a Lipschitz bound of about
+// sqrt(1 + (k*r)^2), r being the largest distance from the y axis
+func Twist(f Field, k float64) Field {
+	return func(p vec3.Vec3) float64 {
+		c, s := math.Cos(k*p.Y), math.Sin(k*p.Y)
+		return f(vec3.Vec3{c*p.X - s*p.Z, p.Y, s*p.X + c*p.Z})
+	}
+}
+
+// distance estimate of the mandelbulb fractal around the origin, roughly
+// the size of the unit sphere
+func Mandelbulb(power float64, iterations int) Field {
+	return func(p vec3.Vec3) float64 {
+		z := p
+		dr := 1.0
+		r := 0.0
+		for i := 0; i < iterations; i++ {
+			r = z.Euclidean_norm()
+			if r > 2 {
+				break
+			}
+			// z stays at the origin for good once it gets there, where the
+			// angles are undefined. r log r goes to 0 there
+			if r < 1e-12 {
+				return 0
+			}
+
+			// raise z to the power in spherical coordinates and add p
+			theta := math.Acos(z.Z/r) * power
+			phi := math.Atan2(z.Y, z.X) * power
+			dr = math.Pow(r, power-1)*power*dr + 1
+			zr := math.Pow(r, power)
+			z = vec3.Vec3{zr * math.Sin(theta) * math.Cos(phi), zr * math.Sin(phi) * math.Sin(theta), zr * math.Cos(theta)}
+			z.Add(p)
+		}
+
+		return 0.5 * math.Log(r) * r / dr
+	}
+}
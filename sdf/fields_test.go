@@ -0,0 +1,31 @@
+package sdf
+
+import (
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"testing"
+)
+
+func Test_mandelbulb_origin(t *testing.T) {
+	bulb := Mandelbulb(8, 12)
+	if d := bulb(vec3.Vec3{0, 0, 0}); d != 0 {
+		t.Errorf("distance %v at the origin, which lies in the set", d)
+	}
+
+	// far away the estimate is about the distance to the unit sphere
+	if d := bulb(vec3.Vec3{0, 0, 5}); math.IsNaN(d) || d < 2 || d > 5 {
+		t.Errorf("distance %v from 5 units away", d)
+	}
+
+	// a ray through the origin finds the surface with a usable normal
+	s := &Surface{Field: bulb, Box: object.Aabb{vec3.Vec3{-1.5, -1.5, -1.5}, vec3.Vec3{1.5, 1.5, 1.5}}, Precision: 0.001}
+	rec := object.New_hit_record()
+	if !s.Hit(&object.Line{vec3.Vec3{0, 0, -3}, vec3.Vec3{0, 0, 1}, 0}, &rec) {
+		t.Fatal("missed the mandelbulb")
+	}
+	n := rec.Geometric_normal
+	if math.IsNaN(rec.T) || math.IsNaN(n.X+n.Y+n.Z) || math.Abs(n.Euclidean_norm()-1) > 1e-9 {
+		t.Errorf("hit at %v with normal %v", rec.T, n)
+	}
+}
@@ -0,0 +1,129 @@
+package sdf
+
+import (
+	"github.com/supermuesli/pathtracer/object"
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+const (
+	max_steps = 512
+	default_precision = 0.01
+)
+
+// signed distance function, returns the distance from p to the surface.
+// negative inside
+type Field func(p vec3.Vec3) float64
+
+// implicit surface rendered by sphere tracing. it implements object.Shape,
+// so it can be mixed with any other primitive in the scene
+type Surface struct {
+	Field Field
+	// the surface has to lie within Box, rays are only marched inside of it
+	Box object.Aabb
+	// upper bound on how fast Field changes, 1 for exact distances. fields
+	// that only estimate the distance, like twisted ones, need a larger
+	// value so that the march never steps through the surface
+	Lipschitz float64
+	// distance below which a point counts as being on the surface,
+	// defaults to 0.01
+	Precision float64
+	Pdf func(vec3.Vec3, vec3.Vec3) vec3.Vec3
+	Mterial object.Material
+}
+
+func (s *Surface) precision() float64 {
+	if s.Precision > 0 {
+		return s.Precision
+	}
+	return default_precision
+}
+
+// central differences approximate the gradient of the field
+func (s *Surface) normal(p vec3.Vec3) vec3.Vec3 {
+	h := s.precision()
+	n := vec3.Vec3{
+		s.Field(vec3.Vec3{p.X + h, p.Y, p.Z}) - s.Field(vec3.Vec3{p.X - h, p.Y, p.Z}),
+		s.Field(vec3.Vec3{p.X, p.Y + h, p.Z}) - s.Field(vec3.Vec3{p.X, p.Y - h, p.Z}),
+		s.Field(vec3.Vec3{p.X, p.Y, p.Z + h}) - s.Field(vec3.Vec3{p.X, p.Y, p.Z - h}),
+	}
+	n.Normalize()
+	return n
+}
+
+func (s *Surface) Hit(ray *object.Line, rec *object.HitRecord) bool {
+	t, t_max, ok := s.Box.Range(ray)
+	if !ok {
+		return false
+	}
+	t_max = math.Min(t_max, rec.T)
+
+	lipschitz := s.Lipschitz
+	if lipschitz < 1 {
+		lipschitz = 1
+	}
+
+	// rays don't have to be normalized (e.g. in object space), distances
+	// along them are measured in multiples of their direction
+	step_scale := 1 / (lipschitz * ray.Dir.Euclidean_norm())
+	eps := s.precision()
+
+	// rays bouncing off the surface start on it, so first leave the
+	// surface before looking for the next hit
+	for i := 0; i < max_steps && t < t_max; i++ {
+		if math.Abs(s.Field(ray.At(t))) >= eps {
+			break
+		}
+		t += eps * step_scale
+	}
+
+	for i := 0; i < max_steps && t < t_max; i++ {
+		d := math.Abs(s.Field(ray.At(t)))
+		if d < eps {
+			p := ray.At(t)
+			n := s.normal(p)
+
+			// implicit surfaces have no natural parameterization, so use
+			// the direction of the normal
+			phi := math.Atan2(n.Z, n.X)
+			if phi < 0 {
+				phi += 2 * math.Pi
+			}
+
+			rec.T = t
+			rec.Position = p
+			rec.Geometric_normal = n
+			rec.Shading_normal = n
+			rec.U = phi / (2 * math.Pi)
+			rec.V = math.Acos(math.Max(-1, math.Min(1, n.Y))) / math.Pi
+			rec.Dpdu = vec3.Vec3{-n.Z, 0, n.X}
+			rec.Dpdv = n
+			rec.Dpdv.Cross(rec.Dpdu)
+			rec.Front_face = ray.Dir.Dot(n) < 0
+			rec.Mterial = &s.Mterial
+			rec.Pdf = s.Pdf
+			rec.Prim_id = 0
+			return true
+		}
+		t += d * step_scale
+	}
+
+	return false
+}
+
+func (s *Surface) Bounds() object.Aabb {
+	return s.Box
+}
+
+// implicit surfaces can't be sampled, so they can't be used as emitters
+// for light sampling
+func (s *Surface) Area() float64 {
+	return 0
+}
+
+func (s *Surface) Sample(u1 float64, u2 float64) (vec3.Vec3, vec3.Vec3) {
+	center := s.Box.Min
+	center.Add(s.Box.Max)
+	center.Scale(0.5)
+	return center, vec3.Vec3{0, 0, 0}
+}
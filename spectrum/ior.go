@@ -0,0 +1,52 @@
+package spectrum
+
+import (
+	"math"
+)
+
+// index of refraction that may vary with the wavelength
+type Ior interface {
+	// index at the wavelength in nanometers
+	At(lambda float64) float64
+}
+
+// the same index at every wavelength
+type Constant float64
+
+func (c Constant) At(lambda float64) float64 {
+	return float64(c)
+}
+
+// cauchy's equation n = A + B / lambda², lambda in micrometers. good for
+// glasses within the visible range
+type Cauchy struct {
+	A, B float64
+}
+
+func (c Cauchy) At(lambda float64) float64 {
+	l := lambda / 1000
+	return c.A + c.B/(l*l)
+}
+
+// sellmeier equation n² = 1 + sum of B lambda² / (lambda² - C), lambda in
+// micrometers. glass manufacturers publish these coefficients
+type Sellmeier struct {
+	B, C [3]float64
+}
+
+func (s Sellmeier) At(lambda float64) float64 {
+	l2 := lambda * lambda / 1e6
+	n2 := 1.0
+	for i := 0; i < 3; i++ {
+		n2 += s.B[i] * l2 / (l2 - s.C[i])
+	}
+	return math.Sqrt(n2)
+}
+
+// common optical glasses, schott data sheets
+var (
+	// crown glass of lenses, little dispersion
+	Bk7 = Sellmeier{[3]float64{1.03961212, 0.231792344, 1.01046945}, [3]float64{0.00600069867, 0.0200179144, 103.560653}}
+	// dense flint glass of prisms, strong dispersion
+	Sf11 = Sellmeier{[3]float64{1.73759695, 0.313747346, 1.89878101}, [3]float64{0.013188707, 0.0623068142, 155.23629}}
+)
@@ -0,0 +1,201 @@
+package spectrum
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// visible range in nanometers
+const (
+	Lambda_min = 380.0
+	Lambda_max = 780.0
+)
+
+// piecewise gaussian lobe
+func lobe(x float64, mu float64, sigma1 float64, sigma2 float64) float64 {
+	t := (x - mu) / sigma1
+	if x >= mu {
+		t = (x - mu) / sigma2
+	}
+	return math.Exp(-t * t / 2)
+}
+
+// cie 1931 color matching functions after wyman, sloan and shirley,
+// "simple analytic approximations to the cie xyz color matching functions"
+func Cie_xyz(lambda float64) (float64, float64, float64) {
+	x := 1.056*lobe(lambda, 599.8, 37.9, 31.0) + 0.362*lobe(lambda, 442.0, 16.0, 26.7) - 0.065*lobe(lambda, 501.1, 20.4, 26.2)
+	y := 0.821*lobe(lambda, 568.8, 46.9, 40.5) + 0.286*lobe(lambda, 530.9, 16.3, 31.1)
+	z := 1.217*lobe(lambda, 437.0, 11.8, 36.0) + 0.681*lobe(lambda, 459.0, 26.0, 13.8)
+	return x, y, z
+}
+
+// cie xyz to linear srgb, colors outside of the gamut come out negative
+func Xyz_to_rgb(x float64, y float64, z float64) vec3.Vec3 {
+	return vec3.Vec3{
+		3.2406*x - 1.5372*y - 0.4986*z,
+		-0.9689*x + 1.8758*y + 0.0415*z,
+		0.0557*x - 0.2040*y + 1.0570*z,
+	}
+}
+
+// relative spectral power of the cie standard illuminant d65, the white of
+// srgb, from 380 nm in steps of 10 nm
+var d65 = [41]float64{
+	49.9755, 54.6482, 82.7549, 91.486, 93.4318, 86.6823, 104.865, 117.008, 117.812, 114.861,
+	115.923, 108.811, 109.354, 107.802, 104.79, 107.689, 104.405, 104.046, 100, 96.3342,
+	95.788, 88.6856, 90.0062, 89.5991, 87.6987, 83.2886, 83.6992, 80.0268, 80.2146, 82.2778,
+	78.2842, 69.7213, 71.6091, 74.349, 61.604, 69.8856, 75.087, 63.5927, 46.4182, 66.8054,
+	63.3828,
+}
+
+func illuminant(lambda float64) float64 {
+	x := math.Max(0, math.Min(40, (lambda-Lambda_min)/10))
+	i := int(math.Min(x, 39))
+	return d65[i] + (x-float64(i))*(d65[i+1]-d65[i])
+}
+
+// spectra that rgb colors are built from after smits, "an rgb to spectrum
+// conversion for reflectances". ten bins from 380 to 720 nm
+var (
+	smits_white   = [10]float64{1, 1, 0.9999, 0.9993, 0.9992, 0.9998, 1, 1, 1, 1}
+	smits_cyan    = [10]float64{0.971, 0.9426, 1.0007, 1.0007, 1.0007, 1.0007, 0.1564, 0, 0, 0}
+	smits_magenta = [10]float64{1, 1, 0.9685, 0.2229, 0, 0.0458, 0.8369, 1, 1, 0.9959}
+	smits_yellow  = [10]float64{0.0001, 0, 0.1088, 0.6651, 1, 1, 0.9996, 0.9586, 0.9685, 0.984}
+	smits_red     = [10]float64{0.1012, 0.0515, 0, 0, 0, 0, 0.8325, 1.0149, 1.0149, 1.0149}
+	smits_green   = [10]float64{0, 0, 0.0273, 0.7937, 1, 0.9418, 0.1719, 0, 0, 0.0025}
+	smits_blue    = [10]float64{1, 1, 0.8916, 0.3323, 0, 0, 0.0003, 0.0369, 0.0483, 0.0496}
+)
+
+// value at lambda of a smooth spectrum that looks like the linear srgb
+// color c. scaling c scales the spectrum, so it works for reflectances as
+// well as for coefficients of media
+func Uplift(c vec3.Vec3, lambda float64) float64 {
+	i := int(math.Max(0, math.Min(9, (lambda-Lambda_min)/34)))
+	r, g, b := c.X, c.Y, c.Z
+
+	// white for the smallest component, the two colors between the other
+	// two on top
+	switch {
+	case r <= g && r <= b:
+		res := r * smits_white[i]
+		if g <= b {
+			return res + (g-r)*smits_cyan[i] + (b-g)*smits_blue[i]
+		}
+		return res + (b-r)*smits_cyan[i] + (g-b)*smits_green[i]
+	case g <= r && g <= b:
+		res := g * smits_white[i]
+		if r <= b {
+			return res + (r-g)*smits_magenta[i] + (b-r)*smits_blue[i]
+		}
+		return res + (b-g)*smits_magenta[i] + (r-b)*smits_red[i]
+	default:
+		res := b * smits_white[i]
+		if r <= g {
+			return res + (r-b)*smits_yellow[i] + (g-r)*smits_green[i]
+		}
+		return res + (g-b)*smits_yellow[i] + (r-g)*smits_red[i]
+	}
+}
+
+// luminance of d65 and the srgb color a white emitter comes out as, which
+// is corrected to exactly white
+var luminance_d65 float64
+var white vec3.Vec3
+
+func init() {
+	var x, y, z float64
+	for lambda := Lambda_min; lambda <= Lambda_max; lambda++ {
+		cx, cy, cz := Cie_xyz(lambda)
+		e := illuminant(lambda)
+		x += cx * e
+		y += cy * e
+		z += cz * e
+	}
+	luminance_d65 = y
+	white = Xyz_to_rgb(x/y, 1, z/y)
+}
+
+// wavelengths a path carries instead of rgb, one per channel of its vec3
+// values. the first is the hero wavelength, picked uniformly, the others
+// are spread evenly from it over the visible range
+type Wavelengths struct {
+	Lambda [3]float64
+	// only the hero wavelength is followed after dispersion
+	Terminated bool
+}
+
+func Sample_wavelengths(u float64) *Wavelengths {
+	w := &Wavelengths{}
+	for i := range w.Lambda {
+		l := u + float64(i)/3
+		w.Lambda[i] = Lambda_min + (l-math.Floor(l))*(Lambda_max-Lambda_min)
+	}
+	return w
+}
+
+// the functions below take a nil *Wavelengths for rgb paths, which carry
+// the colors as they are
+
+// reflectance or coefficient of color c at the wavelengths
+func (w *Wavelengths) Reflectance(c vec3.Vec3) vec3.Vec3 {
+	if w == nil {
+		return c
+	}
+	return vec3.Vec3{Uplift(c, w.Lambda[0]), Uplift(c, w.Lambda[1]), Uplift(c, w.Lambda[2])}
+}
+
+// spectral radiance of light with the color c, white light has the
+// spectrum of d65
+func (w *Wavelengths) Emission(c vec3.Vec3) vec3.Vec3 {
+	if w == nil {
+		return c
+	}
+	res := w.Reflectance(c)
+	res.X *= illuminant(w.Lambda[0])
+	res.Y *= illuminant(w.Lambda[1])
+	res.Z *= illuminant(w.Lambda[2])
+	return res
+}
+
+// index of refraction for the path. dispersive materials bend every
+// wavelength differently, so only the hero wavelength goes on from there.
+// rgb paths use the index at 550 nm
+func (w *Wavelengths) Ior(ior Ior) float64 {
+	if w == nil {
+		return ior.At(550)
+	}
+	n := ior.At(w.Lambda[0])
+	if ior.At(w.Lambda[1]) != n || ior.At(w.Lambda[2]) != n {
+		w.Terminated = true
+	}
+	return n
+}
+
+// linear srgb color of radiance carried at the wavelengths
+func (w *Wavelengths) To_rgb(radiance vec3.Vec3) vec3.Vec3 {
+	if w == nil {
+		return radiance
+	}
+
+	values := [3]float64{radiance.X, radiance.Y, radiance.Z}
+	n := 3
+	if w.Terminated {
+		n = 1
+	}
+
+	// the wavelengths are uniform over the visible range
+	var x, y, z float64
+	for i := 0; i < n; i++ {
+		cx, cy, cz := Cie_xyz(w.Lambda[i])
+		x += values[i] * cx
+		y += values[i] * cy
+		z += values[i] * cz
+	}
+	scale := (Lambda_max - Lambda_min) / float64(n) / luminance_d65
+
+	res := Xyz_to_rgb(x*scale, y*scale, z*scale)
+	res.X /= white.X
+	res.Y /= white.Y
+	res.Z /= white.Z
+	return res
+}
@@ -0,0 +1,422 @@
+package texture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/supermuesli/pathtracer/vec3"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// loads a high dynamic range image from a radiance .hdr or an openexr .exr
+// file. the values are linear and not limited to [0, 1]
+func Load_hdr(path string, wrap Wrap_mode) (*Image, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var img *Image
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exr":
+		img, err = decode_exr(data)
+	default:
+		img, err = decode_rgbe(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	img.Wrap = wrap
+	img.Build_mipmaps()
+	return img, nil
+}
+
+// largest width or height of an image that is decoded, larger ones are
+// assumed to be corrupt
+const max_image_side = 1 << 15
+
+// radiance rgbe format: a text header followed by run length encoded
+// scanlines of pixels that share an exponent
+func decode_rgbe(data []byte) (*Image, error) {
+	br := bytes.NewReader(data)
+	r := bufio.NewReader(br)
+
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "#?") {
+		return nil, errors.New("not a radiance hdr file")
+	}
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, errors.New("truncated header")
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, errors.New("unsupported format " + line)
+		}
+	}
+
+	line, err = r.ReadString('\n')
+	if err != nil {
+		return nil, errors.New("missing resolution")
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(line, "-Y %d +X %d", &height, &width); err != nil {
+		return nil, errors.New("unsupported orientation " + strings.TrimSpace(line))
+	}
+	if width <= 0 || height <= 0 || width > max_image_side || height > max_image_side {
+		return nil, errors.New("bad resolution " + strings.TrimSpace(line))
+	}
+
+	// every scanline takes at least a run of up to 127 pixels for each
+	// component, flat ones 4 bytes per pixel
+	min_scanline := int64(4 * width)
+	if width >= 8 && width <= 0x7fff {
+		min_scanline = int64(4 + 8*((width+126)/127))
+	}
+	if int64(height)*min_scanline > int64(br.Len()+r.Buffered()) {
+		return nil, errors.New("resolution larger than the file " + strings.TrimSpace(line))
+	}
+
+	img := &Image{Width: width, Height: height, Pixels: make([]vec3.Vec3, width*height)}
+	scanline := make([]byte, 4*width)
+	for y := 0; y < height; y++ {
+		if err := read_rgbe_scanline(r, scanline, width); err != nil {
+			return nil, err
+		}
+		for x := 0; x < width; x++ {
+			img.Pixels[y*width+x] = rgbe(scanline[4*x : 4*x+4])
+		}
+	}
+
+	return img, nil
+}
+
+func read_rgbe_scanline(r *bufio.Reader, scanline []byte, width int) error {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return err
+	}
+
+	// flat scanline, only used by small or old files
+	if width < 8 || width > 0x7fff || head[0] != 2 || head[1] != 2 || head[2]&0x80 != 0 {
+		copy(scanline, head[:])
+		_, err := io.ReadFull(r, scanline[4:])
+		return err
+	}
+
+	if int(head[2])<<8|int(head[3]) != width {
+		return errors.New("scanline width mismatch")
+	}
+
+	// each of the four components is run length encoded on its own
+	for c := 0; c < 4; c++ {
+		for x := 0; x < width; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+
+			if count > 128 {
+				n := int(count) - 128
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				if x+n > width {
+					return errors.New("bad run length")
+				}
+				for i := 0; i < n; i++ {
+					scanline[4*(x+i)+c] = value
+				}
+				x += n
+			} else {
+				n := int(count)
+				if n == 0 || x+n > width {
+					return errors.New("bad run length")
+				}
+				for i := 0; i < n; i++ {
+					value, err := r.ReadByte()
+					if err != nil {
+						return err
+					}
+					scanline[4*(x+i)+c] = value
+				}
+				x += n
+			}
+		}
+	}
+
+	return nil
+}
+
+func rgbe(p []byte) vec3.Vec3 {
+	if p[3] == 0 {
+		return vec3.Vec3{0, 0, 0}
+	}
+	f := math.Ldexp(1, int(p[3])-(128+8))
+	return vec3.Vec3{(float64(p[0]) + 0.5) * f, (float64(p[1]) + 0.5) * f, (float64(p[2]) + 0.5) * f}
+}
+
+// openexr pixel types
+const (
+	exr_uint = 0
+	exr_half = 1
+	exr_float = 2
+)
+
+type exr_channel struct {
+	name string
+	pixel_type int32
+}
+
+func (c exr_channel) size() int {
+	if c.pixel_type == exr_half {
+		return 2
+	}
+	return 4
+}
+
+// openexr scanline images, uncompressed or zip compressed. tiled images
+// and the other compression methods aren't supported
+func decode_exr(data []byte) (*Image, error) {
+	le := binary.LittleEndian
+	if len(data) < 8 || le.Uint32(data) != 20000630 {
+		return nil, errors.New("not an openexr file")
+	}
+	if le.Uint32(data[4:])&0x200 != 0 {
+		return nil, errors.New("tiled openexr images are not supported")
+	}
+
+	var channels []exr_channel
+	compression := -1
+	var x_min, y_min, x_max, y_max int32
+	pos := 8
+
+	// null terminated string at pos
+	read_string := func() (string, error) {
+		end := bytes.IndexByte(data[pos:], 0)
+		if end < 0 {
+			return "", errors.New("truncated header")
+		}
+		s := string(data[pos : pos+end])
+		pos += end + 1
+		return s, nil
+	}
+
+	// header attributes, ended by an empty name
+	for {
+		name, err := read_string()
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			break
+		}
+		if _, err := read_string(); err != nil {
+			return nil, err
+		}
+		if pos+4 > len(data) {
+			return nil, errors.New("truncated header")
+		}
+		size := int(le.Uint32(data[pos:]))
+		pos += 4
+		if size > len(data)-pos {
+			return nil, errors.New("truncated header")
+		}
+		value := data[pos : pos+size]
+		pos += size
+
+		switch name {
+		case "channels":
+			for i := 0; i < len(value) && value[i] != 0; {
+				end := bytes.IndexByte(value[i:], 0)
+				if end < 0 || i+end+17 > len(value) {
+					return nil, errors.New("bad channel list")
+				}
+				c := exr_channel{string(value[i : i+end]), int32(le.Uint32(value[i+end+1:]))}
+				channels = append(channels, c)
+				i += end + 17
+			}
+		case "compression":
+			if len(value) < 1 {
+				return nil, errors.New("bad compression attribute")
+			}
+			compression = int(value[0])
+		case "dataWindow":
+			if len(value) < 16 {
+				return nil, errors.New("bad data window")
+			}
+			x_min, y_min = int32(le.Uint32(value)), int32(le.Uint32(value[4:]))
+			x_max, y_max = int32(le.Uint32(value[8:])), int32(le.Uint32(value[12:]))
+		}
+	}
+
+	lines_per_chunk := 0
+	switch compression {
+	case 0, 2:
+		// none, zip with single scanlines
+		lines_per_chunk = 1
+	case 3:
+		// zip with blocks of 16 scanlines
+		lines_per_chunk = 16
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", compression)
+	}
+
+	// channels are stored in alphabetical order
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+	if len(channels) == 0 {
+		return nil, errors.New("no channels")
+	}
+	w, h := int64(x_max)-int64(x_min)+1, int64(y_max)-int64(y_min)+1
+	if w <= 0 || h <= 0 || w > max_image_side || h > max_image_side {
+		return nil, errors.New("bad data window")
+	}
+	width, height := int(w), int(h)
+	line_size := 0
+	for _, c := range channels {
+		line_size += c.size() * width
+	}
+
+	// deflate packs at most about 1032 bytes into one
+	max_bytes := int64(len(data) - pos)
+	if compression != 0 {
+		max_bytes *= 1032
+	}
+	if int64(line_size)*h > max_bytes {
+		return nil, errors.New("data window larger than the file")
+	}
+
+	img := &Image{Width: width, Height: height, Pixels: make([]vec3.Vec3, width*height)}
+	chunks := (height + lines_per_chunk - 1) / lines_per_chunk
+	for i := 0; i < chunks; i++ {
+		if pos+8*i+8 > len(data) {
+			return nil, errors.New("truncated offset table")
+		}
+		// offsets near the largest int must not overflow the bounds checks
+		offset := int(le.Uint64(data[pos+8*i:]))
+		if offset < 0 || offset > len(data)-8 {
+			return nil, errors.New("truncated chunk")
+		}
+		y := int(int32(le.Uint32(data[offset:]))) - int(y_min)
+		if y < 0 || y >= height {
+			return nil, fmt.Errorf("chunk at scanline %d outside of the data window", y+int(y_min))
+		}
+		size := int(le.Uint32(data[offset+4:]))
+		if size > len(data)-offset-8 {
+			return nil, errors.New("truncated chunk")
+		}
+		chunk := data[offset+8 : offset+8+size]
+
+		lines := lines_per_chunk
+		if y+lines > height {
+			lines = height - y
+		}
+		if compression != 0 && size < lines*line_size {
+			var err error
+			if chunk, err = unzip_exr(chunk); err != nil {
+				return nil, err
+			}
+		}
+		if len(chunk) < lines*line_size {
+			return nil, errors.New("truncated chunk")
+		}
+
+		for l := 0; l < lines; l++ {
+			at := l * line_size
+			for _, c := range channels {
+				for x := 0; x < width; x++ {
+					v := exr_value(chunk[at+x*c.size():], c.pixel_type)
+					p := &img.Pixels[(y+l)*width+x]
+					switch c.name {
+					case "R":
+						p.X = v
+					case "G":
+						p.Y = v
+					case "B":
+						p.Z = v
+					case "Y":
+						*p = vec3.Vec3{v, v, v}
+					}
+				}
+				at += c.size() * width
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// undoes the zip compression of openexr, which stores the deltas of the
+// bytes split into two interleaved halves
+func unzip_exr(chunk []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(chunk))
+	if err != nil {
+		return nil, err
+	}
+	t, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 1; i < len(t); i++ {
+		t[i] = byte(int(t[i-1]) + int(t[i]) - 128)
+	}
+
+	res := make([]byte, len(t))
+	half := (len(t) + 1) / 2
+	for i := 0; i < len(t); i++ {
+		if i%2 == 0 {
+			res[i] = t[i/2]
+		} else {
+			res[i] = t[half+i/2]
+		}
+	}
+
+	return res, nil
+}
+
+func exr_value(b []byte, pixel_type int32) float64 {
+	le := binary.LittleEndian
+	switch pixel_type {
+	case exr_half:
+		return half(le.Uint16(b))
+	case exr_float:
+		return float64(math.Float32frombits(le.Uint32(b)))
+	}
+	return float64(le.Uint32(b))
+}
+
+// 16 bit floating point number
+func half(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			return sign * math.Inf(1)
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(1+mant/1024, exp-15)
+}
@@ -0,0 +1,192 @@
+package texture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+func Test_decode_rgbe(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 2 +X 8\n")
+	// first scanline: a single run per component
+	data.Write([]byte{2, 2, 0, 8, 136, 128, 136, 64, 136, 32, 136, 129})
+	// second scanline: literal reds, runs for the rest
+	data.Write([]byte{2, 2, 0, 8, 8, 10, 20, 30, 40, 50, 60, 70, 80, 136, 0, 136, 0, 136, 129})
+
+	img, err := decode_rgbe(data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 8 || img.Height != 2 {
+		t.Fatalf("size %dx%d, want 8x2", img.Width, img.Height)
+	}
+
+	p := img.Pixels[5]
+	if math.Abs(p.X-128.5/128) > 1e-9 || math.Abs(p.Y-64.5/128) > 1e-9 || math.Abs(p.Z-32.5/128) > 1e-9 {
+		t.Errorf("pixel (5, 0) is %v", p)
+	}
+	if p := img.Pixels[8+3]; math.Abs(p.X-40.5/128) > 1e-9 || math.Abs(p.Y-0.5/128) > 1e-9 {
+		t.Errorf("pixel (3, 1) is %v", p)
+	}
+}
+
+func Test_decode_rgbe_resolution(t *testing.T) {
+	// would need terabytes of pixels
+	_, err := decode_rgbe([]byte("#?RADIANCE\n\n-Y 2000000000 +X 2000000000\n"))
+	if err == nil || !strings.Contains(err.Error(), "bad resolution") {
+		t.Errorf("huge resolution: %v", err)
+	}
+
+	// within the limits, but a single byte can't hold 1000 scanlines
+	_, err = decode_rgbe([]byte("#?RADIANCE\n\n-Y 1000 +X 1000\n\x00"))
+	if err == nil || !strings.Contains(err.Error(), "larger than the file") {
+		t.Errorf("resolution larger than the file: %v", err)
+	}
+
+	_, err = decode_rgbe([]byte("#?RADIANCE\n\n-Y -5 +X 8\n"))
+	if err == nil || !strings.Contains(err.Error(), "bad resolution") {
+		t.Errorf("negative height: %v", err)
+	}
+}
+
+func Test_decode_rgbe_bad_run(t *testing.T) {
+	// a run of 9 pixels in a scanline of 8
+	data := "#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x08\x89\x01" + strings.Repeat("\x00", 16)
+	if _, err := decode_rgbe([]byte(data)); err == nil || err.Error() != "bad run length" {
+		t.Errorf("overlong run: %v", err)
+	}
+
+	// scanlines announce their width
+	data = "#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x09" + strings.Repeat("\x00", 16)
+	if _, err := decode_rgbe([]byte(data)); err == nil || err.Error() != "scanline width mismatch" {
+		t.Errorf("wrong width: %v", err)
+	}
+}
+
+// uncompressed openexr image of width x 2 float pixels of a single R
+// channel. the chunks start at the given scanlines
+func exr_file(compression []byte, window []int32, lines [2]int32) []byte {
+	le := binary.LittleEndian
+	var b bytes.Buffer
+	u32 := func(v uint32) {
+		var w [4]byte
+		le.PutUint32(w[:], v)
+		b.Write(w[:])
+	}
+	attribute := func(name string, kind string, value []byte) {
+		b.WriteString(name + "\x00" + kind + "\x00")
+		u32(uint32(len(value)))
+		b.Write(value)
+	}
+
+	u32(20000630)
+	u32(2)
+	channels := append([]byte("R\x00"), 2, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0)
+	attribute("channels", "chlist", channels)
+	attribute("compression", "compression", compression)
+	var box []byte
+	for _, v := range window {
+		var w [4]byte
+		le.PutUint32(w[:], uint32(v))
+		box = append(box, w[:]...)
+	}
+	attribute("dataWindow", "box2i", box)
+	b.WriteByte(0)
+
+	// offset table, then the chunks
+	width := 2
+	chunk := 8 + 4*width
+	start := b.Len() + 16
+	for i := 0; i < 2; i++ {
+		var w [8]byte
+		le.PutUint64(w[:], uint64(start+i*chunk))
+		b.Write(w[:])
+	}
+	for i, y := range lines {
+		u32(uint32(y))
+		u32(uint32(4 * width))
+		for x := 0; x < width; x++ {
+			u32(math.Float32bits(float32(i*width + x + 1)))
+		}
+	}
+	return b.Bytes()
+}
+
+func Test_decode_exr(t *testing.T) {
+	img, err := decode_exr(exr_file([]byte{0}, []int32{0, 0, 1, 1}, [2]int32{0, 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 2 || img.Height != 2 {
+		t.Fatalf("size %dx%d, want 2x2", img.Width, img.Height)
+	}
+	for i, p := range img.Pixels {
+		if p.X != float64(i+1) {
+			t.Errorf("pixel %d has red %v, want %v", i, p.X, i+1)
+		}
+	}
+}
+
+// position of the offset table in files made by exr_file
+func exr_offsets(data []byte) int {
+	return len(data) - 2*(8+4*2) - 16
+}
+
+func Test_decode_exr_chunk_outside_window(t *testing.T) {
+	for _, y := range []int32{-5, 2, 7} {
+		_, err := decode_exr(exr_file([]byte{0}, []int32{0, 0, 1, 1}, [2]int32{0, y}))
+		if err == nil || !strings.Contains(err.Error(), "outside of the data window") {
+			t.Errorf("chunk at scanline %d: %v", y, err)
+		}
+	}
+}
+
+func Test_decode_exr_chunk_bounds(t *testing.T) {
+	le := binary.LittleEndian
+
+	// offsets and sizes that overflow when added to each other
+	data := exr_file([]byte{0}, []int32{0, 0, 1, 1}, [2]int32{0, 1})
+	le.PutUint64(data[exr_offsets(data)+8:], 0x7ffffffffffffffc)
+	if _, err := decode_exr(data); err == nil || err.Error() != "truncated chunk" {
+		t.Errorf("offset near the largest int: %v", err)
+	}
+
+	data = exr_file([]byte{0}, []int32{0, 0, 1, 1}, [2]int32{0, 1})
+	second := int(le.Uint64(data[exr_offsets(data)+8:]))
+	le.PutUint32(data[second+4:], 0xffffffff)
+	if _, err := decode_exr(data); err == nil || err.Error() != "truncated chunk" {
+		t.Errorf("chunk size past the end: %v", err)
+	}
+
+	data = exr_file([]byte{0}, []int32{0, 0, 1, 1}, [2]int32{0, 1})
+	if _, err := decode_exr(data[:len(data)-3]); err == nil || err.Error() != "truncated chunk" {
+		t.Errorf("truncated file: %v", err)
+	}
+}
+
+func Test_decode_exr_data_window(t *testing.T) {
+	for _, c := range []struct {
+		window []int32
+		err string
+	}{
+		// would need exabytes of pixels
+		{[]int32{-2147483648, -2147483648, 2147483647, 2147483647}, "bad data window"},
+		{[]int32{0, 0, -1, 1}, "bad data window"},
+		// within the limits, but far more pixels than the file holds
+		{[]int32{0, 0, 9999, 9999}, "data window larger than the file"},
+		{[]int32{0, 0}, "bad data window"},
+	} {
+		_, err := decode_exr(exr_file([]byte{0}, c.window, [2]int32{0, 1}))
+		if err == nil || err.Error() != c.err {
+			t.Errorf("window %v: %v, want %q", c.window, err, c.err)
+		}
+	}
+
+	_, err := decode_exr(exr_file(nil, []int32{0, 0, 1, 1}, [2]int32{0, 1}))
+	if err == nil || err.Error() != "bad compression attribute" {
+		t.Errorf("empty compression: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package texture
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+)
+
+// what happens to texture coordinates outside of [0, 1]
+type Wrap_mode int
+
+const (
+	// tile the image
+	Repeat Wrap_mode = iota
+	// stretch the border pixels
+	Clamp
+	// tile the image, flipping every other tile
+	Mirror
+)
+
+// bilinearly filtered image. v = 0 is the bottom row of the image
+type Image struct {
+	Width, Height int
+	// row by row from the top, colors in [0, 1]
+	Pixels []vec3.Vec3
+	Wrap Wrap_mode
+	// downsampled copies, each half the size of the one before. see
+	// Build_mipmaps
+	levels []*Image
+}
+
+// loads a png or jpeg image. the stored colors are gamma encoded, so they
+// are converted to linear values first
+func Load_image(path string, wrap Wrap_mode) (*Image, error) {
+	return load(path, wrap, linear)
+}
+
+// loads a png or jpeg image that holds data instead of colors, like normal
+// or height maps. the values are only scaled to [0, 1]
+func Load_data(path string, wrap Wrap_mode) (*Image, error) {
+	return load(path, wrap, func(c uint32) float64 {
+		return float64(c) / 0xffff
+	})
+}
+
+func load(path string, wrap Wrap_mode, decode func(uint32) float64) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	res := &Image{Width: bounds.Dx(), Height: bounds.Dy(), Wrap: wrap}
+	res.Pixels = make([]vec3.Vec3, res.Width*res.Height)
+	for y := 0; y < res.Height; y++ {
+		for x := 0; x < res.Width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			res.Pixels[y*res.Width+x] = vec3.Vec3{decode(r), decode(g), decode(b)}
+		}
+	}
+
+	res.Build_mipmaps()
+	return res, nil
+}
+
+// builds the mipmap pyramid used for filtered lookups. images that are
+// filled in by hand have to call this once their pixels are set
+func (img *Image) Build_mipmaps() {
+	img.levels = nil
+	prev := img
+	for prev.Width > 1 || prev.Height > 1 {
+		next := &Image{Width: max_int(1, prev.Width/2), Height: max_int(1, prev.Height/2), Wrap: img.Wrap}
+		next.Pixels = make([]vec3.Vec3, next.Width*next.Height)
+		for y := 0; y < next.Height; y++ {
+			for x := 0; x < next.Width; x++ {
+				// box filter over the 2x2 pixels below
+				c := prev.pixel(2*x, 2*y)
+				c.Add(prev.pixel(2*x+1, 2*y))
+				c.Add(prev.pixel(2*x, 2*y+1))
+				c.Add(prev.pixel(2*x+1, 2*y+1))
+				c.Scale(0.25)
+				next.Pixels[y*next.Width+x] = c
+			}
+		}
+		img.levels = append(img.levels, next)
+		prev = next
+	}
+}
+
+func max_int(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func linear(c uint32) float64 {
+	return math.Pow(float64(c)/0xffff, 2.2)
+}
+
+// maps a pixel index outside of the image back into it
+func (img *Image) wrap(i int, n int) int {
+	switch img.Wrap {
+	case Clamp:
+		if i < 0 {
+			return 0
+		}
+		if i >= n {
+			return n - 1
+		}
+		return i
+	case Mirror:
+		i = i % (2 * n)
+		if i < 0 {
+			i += 2 * n
+		}
+		if i >= n {
+			i = 2*n - 1 - i
+		}
+		return i
+	}
+
+	i = i % n
+	if i < 0 {
+		i += n
+	}
+	return i
+}
+
+func (img *Image) pixel(x int, y int) vec3.Vec3 {
+	return img.Pixels[img.wrap(y, img.Height)*img.Width+img.wrap(x, img.Width)]
+}
+
+func (img *Image) At(u float64, v float64, p vec3.Vec3) vec3.Vec3 {
+	// pixel centers lie at half integers
+	x := u*float64(img.Width) - 0.5
+	y := (1-v)*float64(img.Height) - 0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+
+	res := vec3.Vec3{0, 0, 0}
+	for _, corner := range [4]struct {
+		dx, dy int
+		w float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		c := img.pixel(ix+corner.dx, iy+corner.dy)
+		c.Scale(corner.w)
+		res.Add(c)
+	}
+
+	return res
+}
+
+// image at the given mipmap level, 0 is the image itself
+func (img *Image) level(l int) *Image {
+	if l <= 0 {
+		return img
+	}
+	if l > len(img.levels) {
+		l = len(img.levels)
+	}
+	return img.levels[l-1]
+}
+
+// trilinear filtering: blends the two mipmap levels whose pixels are
+// closest in size to the footprint
+func (img *Image) At_filtered(u float64, v float64, p vec3.Vec3, dudx float64, dvdx float64, dudy float64, dvdy float64) vec3.Vec3 {
+	// footprint in pixels of the full resolution image
+	w, h := float64(img.Width), float64(img.Height)
+	width := math.Max(math.Hypot(dudx*w, dvdx*h), math.Hypot(dudy*w, dvdy*h))
+	if width <= 1 || len(img.levels) == 0 {
+		return img.At(u, v, p)
+	}
+
+	level := math.Min(math.Log2(width), float64(len(img.levels)))
+	lo := math.Floor(level)
+	t := level - lo
+
+	res := img.level(int(lo)).At(u, v, p)
+	res.Scale(1 - t)
+	hi := img.level(int(lo)+1).At(u, v, p)
+	hi.Scale(t)
+	res.Add(hi)
+	return res
+}
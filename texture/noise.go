@@ -0,0 +1,117 @@
+package texture
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+	"math/rand"
+)
+
+// permutation table of improved perlin noise, doubled so that lookups
+// never have to wrap. it is seeded with a constant so that every render
+// and every frame of an animation sees the same noise
+var perm [512]int
+
+func init() {
+	p := rand.New(rand.NewSource(1)).Perm(256)
+	for i := 0; i < 512; i++ {
+		perm[i] = p[i%256]
+	}
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t float64, a float64, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// dot product of p with one of 12 gradients picked by hash
+func grad(hash int, x float64, y float64, z float64) float64 {
+	h := hash & 15
+	u := y
+	if h < 8 {
+		u = x
+	}
+	v := z
+	if h < 4 {
+		v = y
+	} else if h == 12 || h == 14 {
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
+
+// improved perlin noise, smooth and roughly within [-1, 1]
+func Perlin(p vec3.Vec3) float64 {
+	fx, fy, fz := math.Floor(p.X), math.Floor(p.Y), math.Floor(p.Z)
+	x, y, z := p.X-fx, p.Y-fy, p.Z-fz
+	xi, yi, zi := int(fx)&255, int(fy)&255, int(fz)&255
+	u, v, w := fade(x), fade(y), fade(z)
+
+	a := perm[xi] + yi
+	aa, ab := perm[a]+zi, perm[a+1]+zi
+	b := perm[xi+1] + yi
+	ba, bb := perm[b]+zi, perm[b+1]+zi
+
+	return lerp(w,
+		lerp(v,
+			lerp(u, grad(perm[aa], x, y, z), grad(perm[ba], x-1, y, z)),
+			lerp(u, grad(perm[ab], x, y-1, z), grad(perm[bb], x-1, y-1, z))),
+		lerp(v,
+			lerp(u, grad(perm[aa+1], x, y, z-1), grad(perm[ba+1], x-1, y, z-1)),
+			lerp(u, grad(perm[ab+1], x, y-1, z-1), grad(perm[bb+1], x-1, y-1, z-1))))
+}
+
+// fractional brownian motion, sums octaves of perlin noise that each have
+// twice the frequency and half the amplitude of the one before
+func Fbm(p vec3.Vec3, octaves int) float64 {
+	res := 0.0
+	amplitude := 1.0
+	for i := 0; i < octaves; i++ {
+		res += amplitude * Perlin(p)
+		p.Scale(2)
+		amplitude *= 0.5
+	}
+	return res
+}
+
+// solid fbm noise blending between Low and High. Scale is the size of the
+// coarsest features in world units. with Marble set the noise distorts
+// stripes along x instead, which looks like veined stone
+type Noise struct {
+	Low, High vec3.Vec3
+	Scale float64
+	Octaves int
+	Marble bool
+}
+
+func (n *Noise) At(u float64, v float64, p vec3.Vec3) vec3.Vec3 {
+	octaves := n.Octaves
+	if octaves < 1 {
+		octaves = 1
+	}
+	q := p
+	if n.Scale > 0 {
+		q.Scale(1 / n.Scale)
+	}
+
+	t := 0.5 + 0.5*Fbm(q, octaves)
+	if n.Marble {
+		t = 0.5 + 0.5*math.Sin(2*math.Pi*q.X+5*Fbm(q, octaves))
+	}
+	t = math.Max(0, math.Min(1, t))
+
+	res := n.Low
+	res.Scale(1 - t)
+	high := n.High
+	high.Scale(t)
+	res.Add(high)
+	return res
+}
@@ -0,0 +1,80 @@
+package texture
+
+import (
+	"github.com/supermuesli/pathtracer/vec3"
+	"math"
+)
+
+// value that varies over a surface. u, v are the texture coordinates of
+// the hit and p its position in world space, so textures can either be
+// painted onto the surface or be solid, i.e. carved out of a volume.
+// scalar parameters like roughness only use the first channel
+type Texture interface {
+	At(u float64, v float64, p vec3.Vec3) vec3.Vec3
+}
+
+// textures that can average over the footprint of a pixel instead of
+// returning the value at a single point. the footprint is given by how
+// much u and v change from one pixel to the next in x and y
+type Filtered interface {
+	At_filtered(u float64, v float64, p vec3.Vec3, dudx float64, dvdx float64, dudy float64, dvdy float64) vec3.Vec3
+}
+
+// looks up t, filtered over the footprint if t supports it
+func Lookup(t Texture, u float64, v float64, p vec3.Vec3, dudx float64, dvdx float64, dudy float64, dvdy float64) vec3.Vec3 {
+	if f, ok := t.(Filtered); ok {
+		return f.At_filtered(u, v, p, dudx, dvdx, dudy, dvdy)
+	}
+	return t.At(u, v, p)
+}
+
+// the same value everywhere
+type Constant struct {
+	Color vec3.Vec3
+}
+
+func (c *Constant) At(u float64, v float64, p vec3.Vec3) vec3.Vec3 {
+	return c.Color
+}
+
+// checkerboard alternating between Even and Odd. Frequency is the number
+// of squares along u and v. solid checkers are made of cubes in world
+// space with a side length of 1/Frequency
+type Checker struct {
+	Even, Odd Texture
+	Frequency float64
+	Solid bool
+}
+
+func (c *Checker) At(u float64, v float64, p vec3.Vec3) vec3.Vec3 {
+	cells := math.Floor(u*c.Frequency) + math.Floor(v*c.Frequency)
+	if c.Solid {
+		cells = math.Floor(p.X*c.Frequency) + math.Floor(p.Y*c.Frequency) + math.Floor(p.Z*c.Frequency)
+	}
+
+	if int(cells)%2 == 0 {
+		return c.Even.At(u, v, p)
+	}
+	return c.Odd.At(u, v, p)
+}
+
+// linear blend from From to To along u, or along v if Vertical is set
+type Gradient struct {
+	From, To vec3.Vec3
+	Vertical bool
+}
+
+func (g *Gradient) At(u float64, v float64, p vec3.Vec3) vec3.Vec3 {
+	t := u
+	if g.Vertical {
+		t = v
+	}
+	t = math.Max(0, math.Min(1, t))
+
+	res := g.From
+	res.Scale(1 - t)
+	to := g.To
+	to.Scale(t)
+	res.Add(to)
+	return res
+}